@@ -0,0 +1,82 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	connector "storj-ipfs/connector"
+	logging "storj-ipfs/logging"
+)
+
+// Exit statuses of the commands, so scripts can react to the kind of failure.
+const (
+	exitFailure           = 1
+	exitUsage             = 2
+	exitConfigInvalid     = 3
+	exitDaemonUnavailable = 4
+	exitInvalidHash       = 5
+	exitAccessDenied      = 6
+	exitDecrypt           = 7
+	exitChunkMissing      = 8
+	// exitInterrupted is the status of a command stopped by an interrupt, as shells report it.
+	exitInterrupted = 130
+)
+
+// exitCode returns the exit status for the error a command failed with.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, connector.ErrConfigInvalid):
+		return exitConfigInvalid
+	case errors.Is(err, connector.ErrDaemonUnavailable):
+		return exitDaemonUnavailable
+	case errors.Is(err, connector.ErrInvalidHash):
+		return exitInvalidHash
+	case errors.Is(err, connector.ErrAccessDenied):
+		return exitAccessDenied
+	case errors.Is(err, connector.ErrDecrypt):
+		return exitDecrypt
+	case errors.Is(err, connector.ErrChunkMissing):
+		return exitChunkMissing
+	}
+	return exitFailure
+}
+
+// interruptContext returns a context cancelled by the first interrupt or termination signal,
+// so the running command stops cleanly, logging it to logger. A second signal exits right away.
+// The returned stop function stops listening for the signals.
+func interruptContext(logger *logging.Logger) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+
+	go func() {
+		select {
+		case <-signals:
+		case <-stopped:
+			return
+		}
+		logger.Warn("Interrupted, stopping")
+		cancel()
+
+		select {
+		case <-signals:
+			os.Exit(exitInterrupted)
+		case <-stopped:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(stopped)
+		cancel()
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	connector "storj-ipfs/connector"
+	errs "storj-ipfs/errs"
+	logging "storj-ipfs/logging"
+)
+
+func TestExitCode(t *testing.T) {
+	codes := map[int]error{}
+	for _, test := range []struct {
+		err  error
+		code int
+	}{
+		{err: connector.ErrConfigInvalid, code: exitConfigInvalid},
+		{err: connector.ErrDaemonUnavailable, code: exitDaemonUnavailable},
+		{err: connector.ErrInvalidHash, code: exitInvalidHash},
+		{err: connector.ErrAccessDenied, code: exitAccessDenied},
+		{err: connector.ErrDecrypt, code: exitDecrypt},
+		{err: connector.ErrChunkMissing, code: exitChunkMissing},
+		{err: context.Canceled, code: exitInterrupted},
+		{err: errors.New("failed"), code: exitFailure},
+	} {
+		if previous, ok := codes[test.code]; ok {
+			t.Errorf("%v and %v both exit with %d", test.err, previous, test.code)
+		}
+		codes[test.code] = test.err
+
+		for name, err := range map[string]error{
+			"errs":      errs.Wrap(test.err, errors.New("cause"), "message"),
+			"fmt":       fmt.Errorf("context: %w", errs.Wrap(test.err, nil, "message")),
+			"connector": &connector.Error{Op: "store", Err: fmt.Errorf("context: %w", errs.Wrap(test.err, nil, "message"))},
+		} {
+			if code := exitCode(err); code != test.code {
+				t.Errorf("%v through %s: exit status %d, expected %d", test.err, name, code, test.code)
+			}
+		}
+	}
+	if code := exitCode(&connector.Error{Op: "store", Err: fmt.Errorf("could not upload chunk 0: %w", context.Canceled)}); code != exitInterrupted {
+		t.Errorf("interrupted store: exit status %d, expected %d", code, exitInterrupted)
+	}
+	if err, ok := codes[exitUsage]; ok {
+		t.Errorf("%v exits with the status of invalid usage", err)
+	}
+}
+
+func TestInterruptContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupts cannot be sent on Windows")
+	}
+	logs := &bytes.Buffer{}
+	ctx, stop := interruptContext(logging.New(logs, logging.LevelInfo, logging.FormatText))
+	defer stop()
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("interrupt did not cancel the context")
+	}
+	if code := exitCode(fmt.Errorf("could not upload: %w", ctx.Err())); code != exitInterrupted {
+		t.Errorf("exit status %d, expected %d", code, exitInterrupted)
+	}
+	// The interrupt is logged before the context is cancelled.
+	if !strings.Contains(logs.String(), "Interrupted") {
+		t.Errorf("interrupt not logged: %q", logs.String())
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	logging "storj-ipfs/logging"
+
+	"github.com/urfave/cli"
+)
+
+// Authentication methods selected with --auth.
+const (
+	authKey   = "key"
+	authScope = "scope"
+)
+
+// commandOptions are the settings of a command, read from its flags
+// or from the deprecated positional arguments.
+type commandOptions struct {
+	ipfsConfig  string
+	storjConfig string
+	// keyValue is "key" to access Storj with the API key, as the positional form spells it.
+	keyValue string
+	// restrict is "restrict" to share a restricted scope key, as the positional form spells it.
+	restrict string
+	resume   bool
+	// chunkSize, if positive, overrides the chunking of the IPFS configuration.
+	chunkSize int64
+	// output, if set, overrides the download path of the download configuration.
+	output string
+	// debug verifies uploads and logs detailed progress, unless --log-level is set.
+	debug bool
+}
+
+// ipfsConfigFlag returns the --ipfs-config flag with the given default file.
+func ipfsConfigFlag(defaultFile string, usage string) cli.Flag {
+	return &cli.StringFlag{Name: "ipfs-config", Aliases: []string{"i"}, Value: defaultFile, TakesFile: true, Usage: usage}
+}
+
+// storjConfigFlag returns the --storj-config flag.
+func storjConfigFlag() cli.Flag {
+	return &cli.StringFlag{Name: "storj-config", Aliases: []string{"s"}, Value: storjConfigFile, TakesFile: true, Usage: "read the Storj configuration from `FILE`"}
+}
+
+// authFlag returns the --auth flag.
+func authFlag() cli.Flag {
+	return &cli.StringFlag{Name: "auth", Value: authScope, Usage: "access Storj with the API `METHOD`: \"key\" (API key, satellite and passphrase) or \"scope\" (serialized scope key)"}
+}
+
+// restrictFlag returns the --restrict flag.
+func restrictFlag() cli.Flag {
+	return &cli.BoolFlag{Name: "restrict", Usage: "with --auth=key, share a scope key restricted by the disallow settings"}
+}
+
+// debugFlag returns the --debug flag.
+func debugFlag() cli.Flag {
+	return &cli.BoolFlag{Name: "debug", Usage: "log detailed progress and verify uploads"}
+}
+
+// logFlags returns the --log-level and --log-format flags, which apply to every command.
+func logFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "log-level", Value: "info", Usage: "log records of `LEVEL` and above: debug, info, warn or error"},
+		&cli.StringFlag{Name: "log-format", Value: "text", Usage: "write log records as `FORMAT`: text or json"},
+	}
+}
+
+// setLogging adds the log flags to the app, setting the level and format of logger from them
+// before any command runs.
+func setLogging(logger *logging.Logger) {
+	app.Flags = append(app.Flags, logFlags()...)
+	app.Before = func(cliContext *cli.Context) error {
+		level, err := logging.ParseLevel(cliContext.String("log-level"))
+		if err != nil {
+			return usageError(fmt.Errorf("invalid --log-level %q: use debug, info, warn or error", cliContext.String("log-level")))
+		}
+		format, err := logging.ParseFormat(cliContext.String("log-format"))
+		if err != nil {
+			return usageError(fmt.Errorf("invalid --log-format %q: use text or json", cliContext.String("log-format")))
+		}
+		logger.SetLevel(level)
+		logger.SetFormat(format)
+		return nil
+	}
+}
+
+// storeFlags returns the flags of the store and pinset commands.
+func storeFlags() []cli.Flag {
+	return []cli.Flag{
+		ipfsConfigFlag(ipfsConfigFile, "read the IPFS configuration from `FILE`"),
+		storjConfigFlag(),
+		authFlag(),
+		restrictFlag(),
+		&cli.Int64Flag{Name: "chunk-size", Usage: "split data into chunks of `BYTES`, overriding chunkSize and chunker"},
+		&cli.BoolFlag{Name: "resume", Usage: "resume the interrupted upload of the same data"},
+		debugFlag(),
+	}
+}
+
+// downloadFlags returns the flags of the download and restore commands.
+func downloadFlags(output bool) []cli.Flag {
+	flags := []cli.Flag{
+		ipfsConfigFlag(iPFSDownloadFile, "read the download configuration from `FILE`"),
+		authFlag(),
+		debugFlag(),
+	}
+	if output {
+		flags = append(flags, &cli.StringFlag{Name: "output", Aliases: []string{"o"}, TakesFile: true, Usage: "download into `DIR`, overriding downloadPath"})
+	}
+	return flags
+}
+
+// testFlags returns the flags of the test command.
+func testFlags() []cli.Flag {
+	return []cli.Flag{storjConfigFlag(), authFlag(), restrictFlag(), debugFlag()}
+}
+
+// readOptions returns the options of a command from its flags. Positional arguments are
+// still accepted with a deprecation warning: positional reads them the old way,
+// and any flag given as well takes precedence.
+func readOptions(cliContext *cli.Context, positional func(args []string) commandOptions) (commandOptions, error) {
+	options := commandOptions{ipfsConfig: cliContext.String("ipfs-config"), storjConfig: cliContext.String("storj-config")}
+	if cliContext.Args().Present() {
+		logging.FromContext(cliContext.Context).Warn("Positional arguments are deprecated, use the flags instead", logging.Any("help", cliContext.Command.Name+" --help"))
+		options = positional(cliContext.Args().Slice())
+	}
+
+	if cliContext.IsSet("ipfs-config") {
+		options.ipfsConfig = cliContext.String("ipfs-config")
+	}
+	if cliContext.IsSet("storj-config") {
+		options.storjConfig = cliContext.String("storj-config")
+	}
+	if cliContext.IsSet("auth") {
+		switch auth := cliContext.String("auth"); auth {
+		case authKey:
+			options.keyValue = "key"
+		case authScope:
+			options.keyValue = ""
+		default:
+			return options, fmt.Errorf("invalid --auth %q: use \"key\" or \"scope\"", auth)
+		}
+	}
+	if cliContext.Bool("restrict") {
+		options.restrict = "restrict"
+	}
+	if cliContext.Bool("resume") {
+		options.resume = true
+	}
+	if cliContext.IsSet("chunk-size") {
+		options.chunkSize = cliContext.Int64("chunk-size")
+		if options.chunkSize <= 0 {
+			return options, fmt.Errorf("invalid --chunk-size %d: must be positive", options.chunkSize)
+		}
+	}
+	if cliContext.IsSet("output") {
+		options.output = cliContext.String("output")
+		if options.output == "" {
+			return options, fmt.Errorf("invalid --output: must not be empty")
+		}
+	}
+	if cliContext.Bool("debug") {
+		options.debug = true
+	}
+	if options.debug && !cliContext.IsSet("log-level") {
+		logging.FromContext(cliContext.Context).SetLevel(logging.LevelDebug)
+	}
+
+	if options.restrict != "" && options.keyValue != "key" {
+		if cliContext.Bool("restrict") {
+			return options, fmt.Errorf("--restrict needs --auth=key")
+		}
+		// The positional form only restricted the scope key shared with "key" and ignored "restrict" otherwise.
+		logging.FromContext(cliContext.Context).Warn("Ignoring restrict without key, use --auth=key --restrict to share a restricted scope key")
+		options.restrict = ""
+	}
+	// Commands without a configuration file leave its name empty.
+	if options.ipfsConfig != "" {
+		if err := checkFile("ipfs-config", options.ipfsConfig); err != nil {
+			return options, err
+		}
+	}
+	if options.storjConfig != "" {
+		if err := checkFile("storj-config", options.storjConfig); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+// testOptions reads the deprecated positional arguments of the test command.
+func testOptions(args []string) commandOptions {
+	var options commandOptions
+	options.storjConfig, options.keyValue, options.restrict, options.debug = testArguments(args)
+	return options
+}
+
+// storeOptions reads the deprecated positional arguments of the store and pinset commands.
+func storeOptions(args []string) commandOptions {
+	var options commandOptions
+	options.ipfsConfig, options.storjConfig, options.keyValue, options.restrict, options.resume, options.debug = storeArguments(args)
+	return options
+}
+
+// downloadOptions reads the deprecated positional arguments of the download and restore commands.
+func downloadOptions(args []string) commandOptions {
+	var options commandOptions
+	options.ipfsConfig, options.keyValue, options.debug = downloadArguments(args)
+	return options
+}
+
+// usageError reports invalid command-line input, exiting with status exitUsage.
+func usageError(err error) error {
+	return cli.Exit("Error: "+err.Error(), exitUsage)
+}
+
+// checkFile returns an error if the configuration file at path cannot be read.
+func checkFile(flagName string, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("invalid --%s: %v", flagName, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("invalid --%s: %s is a directory", flagName, path)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	logging "storj-ipfs/logging"
+
+	"github.com/urfave/cli"
+)
+
+// runOptions runs a command with flags and args, reading its options with readOptions,
+// and returns them with the records logged.
+func runOptions(t *testing.T, flags []cli.Flag, positional func(args []string) commandOptions, args ...string) (commandOptions, string, error) {
+	var options commandOptions
+	var err error
+	logs := &bytes.Buffer{}
+	logger := logging.New(logs, logging.LevelInfo, logging.FormatText)
+	testApp := &cli.App{
+		Name: "storj-ipfs",
+		Commands: []*cli.Command{{
+			Name:  "command",
+			Flags: flags,
+			Action: func(cliContext *cli.Context) error {
+				options, err = readOptions(cliContext, positional)
+				return nil
+			},
+		}},
+	}
+	if runErr := testApp.RunContext(logging.NewContext(context.Background(), logger), append([]string{"storj-ipfs", "command"}, args...)); runErr != nil {
+		t.Fatal(runErr)
+	}
+	return options, logs.String(), err
+}
+
+// configFiles writes an IPFS and a Storj configuration file to a temporary directory.
+func configFiles(t *testing.T) (dir string, ipfsConfig string, storjConfig string) {
+	dir, err := ioutil.TempDir("", "storj-ipfs-flags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipfsConfig = filepath.Join(dir, "ipfs.json")
+	storjConfig = filepath.Join(dir, "storj.json")
+	for _, path := range []string{ipfsConfig, storjConfig} {
+		if err := ioutil.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, ipfsConfig, storjConfig
+}
+
+func TestReadOptions(t *testing.T) {
+	dir, ipfsConfig, storjConfig := configFiles(t)
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		args     []string
+		expected commandOptions
+	}{
+		{
+			args:     []string{"--ipfs-config", ipfsConfig, "--storj-config", storjConfig},
+			expected: commandOptions{ipfsConfig: ipfsConfig, storjConfig: storjConfig},
+		},
+		{
+			args:     []string{"-i", ipfsConfig, "-s", storjConfig, "--auth", "key", "--restrict", "--chunk-size", "1024", "--resume", "--debug"},
+			expected: commandOptions{ipfsConfig: ipfsConfig, storjConfig: storjConfig, keyValue: "key", restrict: "restrict", resume: true, chunkSize: 1024, debug: true},
+		},
+		{
+			args:     []string{"--ipfs-config", ipfsConfig, "--storj-config", storjConfig, "--auth", "scope"},
+			expected: commandOptions{ipfsConfig: ipfsConfig, storjConfig: storjConfig},
+		},
+	} {
+		options, logs, err := runOptions(t, storeFlags(), storeOptions, test.args...)
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		if options != test.expected {
+			t.Errorf("%q: read %+v, expected %+v", test.args, options, test.expected)
+		}
+		if strings.Contains(logs, "deprecated") {
+			t.Errorf("%q: warned about positional arguments: %s", test.args, logs)
+		}
+	}
+
+	options, _, err := runOptions(t, downloadFlags(true), downloadOptions, "--ipfs-config", ipfsConfig, "--auth", "key", "--output", dir)
+	if expected := (commandOptions{ipfsConfig: ipfsConfig, keyValue: "key", output: dir}); err != nil || options != expected {
+		t.Errorf("download read %+v, expected %+v: %v", options, expected, err)
+	}
+}
+
+func TestReadOptionsInvalid(t *testing.T) {
+	dir, ipfsConfig, storjConfig := configFiles(t)
+	defer os.RemoveAll(dir)
+
+	configs := []string{"--ipfs-config", ipfsConfig, "--storj-config", storjConfig}
+	for _, test := range []struct {
+		args    []string
+		message string
+	}{
+		{args: append(configs, "--auth", "password"), message: "invalid --auth"},
+		{args: append(configs, "--auth", ""), message: "invalid --auth"},
+		{args: append(configs, "--chunk-size", "0"), message: "invalid --chunk-size"},
+		{args: append(configs, "--chunk-size", "-1"), message: "invalid --chunk-size"},
+		{args: append(configs, "--restrict"), message: "--restrict needs --auth=key"},
+		{args: append(configs, "--auth", "scope", "--restrict"), message: "--restrict needs --auth=key"},
+		{args: []string{"--ipfs-config", filepath.Join(dir, "missing.json"), "--storj-config", storjConfig}, message: "invalid --ipfs-config"},
+		{args: []string{"--ipfs-config", ipfsConfig, "--storj-config", dir}, message: "is a directory"},
+	} {
+		if _, _, err := runOptions(t, storeFlags(), storeOptions, test.args...); err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%q: %v, expected %q", test.args, err, test.message)
+		}
+	}
+
+	if _, _, err := runOptions(t, downloadFlags(true), downloadOptions, "--ipfs-config", ipfsConfig, "--output", ""); err == nil || !strings.Contains(err.Error(), "invalid --output") {
+		t.Errorf("empty --output: %v", err)
+	}
+}
+
+func TestReadOptionsPositional(t *testing.T) {
+	dir, ipfsConfig, storjConfig := configFiles(t)
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		args     []string
+		expected commandOptions
+		// ignored is set when "restrict" is given without "key", which the positional form ignored.
+		ignored bool
+	}{
+		{
+			args:     []string{ipfsConfig, storjConfig},
+			expected: commandOptions{ipfsConfig: ipfsConfig, storjConfig: storjConfig},
+		},
+		{
+			args:     []string{"debug", ipfsConfig, storjConfig, "key", "resume", "restrict"},
+			expected: commandOptions{ipfsConfig: ipfsConfig, storjConfig: storjConfig, keyValue: "key", restrict: "restrict", resume: true, debug: true},
+		},
+		{
+			args:     []string{ipfsConfig, storjConfig, "scope", "restrict"},
+			expected: commandOptions{ipfsConfig: ipfsConfig, storjConfig: storjConfig, keyValue: "scope"},
+			ignored:  true,
+		},
+		{
+			args:     []string{ipfsConfig, storjConfig, "restrict"},
+			expected: commandOptions{ipfsConfig: ipfsConfig, storjConfig: storjConfig, keyValue: "restrict"},
+		},
+		// Flags take precedence over the positional arguments after them.
+		{
+			args:     []string{"--auth", "key", "--chunk-size", "2048", ipfsConfig, storjConfig, "scope", "restrict"},
+			expected: commandOptions{ipfsConfig: ipfsConfig, storjConfig: storjConfig, keyValue: "key", restrict: "restrict", chunkSize: 2048},
+		},
+		{
+			args:     []string{"--storj-config", storjConfig, ipfsConfig, filepath.Join(dir, "missing.json")},
+			expected: commandOptions{ipfsConfig: ipfsConfig, storjConfig: storjConfig},
+		},
+	} {
+		options, logs, err := runOptions(t, storeFlags(), storeOptions, test.args...)
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		if options != test.expected {
+			t.Errorf("%q: read %+v, expected %+v", test.args, options, test.expected)
+		}
+		if !strings.Contains(logs, "Positional arguments are deprecated") {
+			t.Errorf("%q: no deprecation warning in %q", test.args, logs)
+		}
+		if ignored := strings.Contains(logs, "Ignoring restrict"); ignored != test.ignored {
+			t.Errorf("%q: restrict ignored %t, expected %t: %s", test.args, ignored, test.ignored, logs)
+		}
+	}
+
+	options, _, err := runOptions(t, testFlags(), testOptions, storjConfig, "key", "restrict")
+	if expected := (commandOptions{storjConfig: storjConfig, keyValue: "key", restrict: "restrict"}); err != nil || options != expected {
+		t.Errorf("test read %+v, expected %+v: %v", options, expected, err)
+	}
+	options, _, err = runOptions(t, downloadFlags(true), downloadOptions, ipfsConfig, "key", "debug")
+	if expected := (commandOptions{ipfsConfig: ipfsConfig, keyValue: "key", debug: true}); err != nil || options != expected {
+		t.Errorf("download read %+v, expected %+v: %v", options, expected, err)
+	}
+	// A missing configuration is still rejected.
+	if _, _, err := runOptions(t, downloadFlags(true), downloadOptions, filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("read a missing positional download configuration")
+	}
+}
@@ -4,25 +4,21 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"log"
 
 	"os"
 	"path/filepath"
+	connector "storj-ipfs/connector"
+	errs "storj-ipfs/errs"
 	ipfs "storj-ipfs/ipfs"
+	logging "storj-ipfs/logging"
 	storj "storj-ipfs/storj"
+	timeouts "storj-ipfs/timeouts"
 	"time"
 
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"encoding/base64"
-
-	shell "github.com/ipfs/go-ipfs-api"
-	chunker "github.com/ipfs/go-ipfs-chunker"
 	"github.com/urfave/cli"
 )
 
@@ -31,8 +27,6 @@ const ipfsConfigFile = "./config/ipfs_upload.json"
 const storjConfigFile = "./config/storj_config.json"
 const iPFSDownloadFile = "./config/ipfs_download.json"
 
-var gbDEBUG = false
-
 // Create command-line tool to read from CLI.
 var app = cli.NewApp()
 
@@ -45,368 +39,399 @@ func setAppInfo() {
 
 }
 
-// Helper function to flag debug
-func setDebug(debugVal bool) {
-	gbDEBUG = debugVal
-	ipfs.DEBUG = debugVal
-	storj.DEBUG = debugVal
-}
-
 // setCommands sets various command-line options for the app.
 func setCommands() {
 
 	app.Commands = []*cli.Command{
 		{
-			Name:    "test",
-			Aliases: []string{"t"},
-			Usage:   "Command to read and parse JSON information about Storj network and upload sample JSON data",
-			//\n arguments- 1. fileName [optional] = provide full file name (with complete path), storing Storj configuration information if this fileName is not given, then data is read from ./config/storj_config.json example = ./storj_mongodb s ./config/storj_config.json\n\n\n",
+			Name:      "test",
+			Aliases:   []string{"t"},
+			Usage:     "Command to read and parse JSON information about Storj network and upload sample JSON data",
+			UsageText: "storj-ipfs test [--storj-config FILE] [--auth key|scope] [--restrict] [--debug]\n\n   Deprecated: storj-ipfs test [storjConfig] [key] [restrict] [debug]",
+			Flags:     testFlags(),
 			Action: func(cliContext *cli.Context) error {
 
-				// Default Storj configuration file name.
-				var fullFileName = storjConfigFile
-				var key string
-				var restrict string
-				var foundFirstFileName = false
-				var foundSecondFileName = false
-				// process arguments
-				if len(cliContext.Args().Slice()) > 0 {
-					for i := 0; i < len(cliContext.Args().Slice()); i++ {
-
-						// Incase, debug is provided as argument.
-						if cliContext.Args().Slice()[i] == "debug" {
-							setDebug(true)
-						} else {
-							if !foundFirstFileName {
-								fullFileName = cliContext.Args().Slice()[i]
-								foundFirstFileName = true
-							} else {
-								if !foundSecondFileName {
-									key = cliContext.Args().Slice()[i]
-									foundSecondFileName = true
-								} else {
-									restrict = cliContext.Args().Slice()[i]
-								}
-							}
-						}
-					}
+				// process arguments - Reading the flags or the deprecated positional arguments.
+				options, err := readOptions(cliContext, testOptions)
+				if err != nil {
+					return usageError(err)
 				}
+				fullFileName, key, restrict := options.storjConfig, options.keyValue, options.restrict
+				ctx := cliContext.Context
+				logger := logging.FromContext(ctx)
 				// Sample database name and data to be uploaded
 				fileName := "testdata"
 				testData := "test"
 				// Converting JSON data to bson data.  TODO: convert to BSON using call to mongo library
 				data := []byte(testData)
-				if gbDEBUG {
+				if options.debug {
 					t := time.Now()
 					time := t.Format("2006-01-02")
 					fileName = "uploaddata_" + time + ".txt"
 					err := ioutil.WriteFile(fileName, data, 0644)
 					if err != nil {
-						fmt.Println("Error while writting to file ", err)
+						logger.Warn("Could not write test data file", logging.Any("file", fileName), logging.Err(err))
 					}
 				}
 
-				var fileNamesDEBUG []string
-				var uploadStatus bool
 				// Connect to storj network.
-				ctx, uplink, project, bucket, storjConfig, _, errr := storj.ConnectStorjReadUploadData(fullFileName, key, restrict)
+				store, closeStore, storjConfig, _, err := storj.ConnectStorjReadUploadData(ctx, fullFileName, key, restrict)
+				if err != nil {
+					return err
+				}
+				// Close the storj project.
+				defer closeStore()
 
 				// Upload sample data on storj network.
-				fileNamesDEBUG, uploadStatus = storj.ConnectUpload(ctx, bucket, data, fileName, fileNamesDEBUG, storjConfig, errr)
-
-				if uploadStatus != true {
-					fmt.Println("\nUpload data to IPFS failed.")
-					// Close the storj project.
-					storj.CloseProject(uplink, project, bucket)
-					return errr
+				if err := storj.ConnectUpload(ctx, store, data, fileName, storjConfig); err != nil {
+					return err
 				}
 
-				// Close storj project.
-				storj.CloseProject(uplink, project, bucket)
-				//
+				// The result goes to stdout, apart from the log records on stderr.
 				fmt.Println("\nUpload \"testdata\" on Storj: Successful!")
-				return errr
+				return nil
 			},
 		},
 		{
-			Name:    "store",
-			Aliases: []string{"s"},
-			Usage:   "Command to connect and transfer ALL files from a desired IPFS instance to given Storj Bucket.",
-			//\n    arguments-\n      1. fileName [optional] = provide full file name (with complete path), storing IPFS properties in JSON format\n   if this fileName is not given, then data is read from ./config/ipfs_upload.json\n      2. fileName [optional] = provide full file name (with complete path), storing Storj configuration in JSON format\n     if this fileName is not given, then data is read from ./config/storj_config.json\n   example = ./storj-ipfs store ./config/ipfs_upload.json ./config/storj_config.json\n",
+			Name:      "store",
+			Aliases:   []string{"s"},
+			Usage:     "Command to connect and transfer ALL files from a desired IPFS instance to given Storj Bucket.",
+			UsageText: "storj-ipfs store [--ipfs-config FILE] [--storj-config FILE] [--auth key|scope] [--restrict] [--chunk-size BYTES] [--resume] [--debug]\n\n   Deprecated: storj-ipfs store [ipfsConfig] [storjConfig] [key] [restrict] [resume] [debug]",
+			Flags:     storeFlags(),
 			Action: func(cliContext *cli.Context) error {
 
-				// Default configuration file names.
-				var fullFileNameStorj = storjConfigFile
-				var fullFileNameIPFS = ipfsConfigFile
-				var keyValue string
-				var restrict string
-				// process arguments - Reading fileName from the command line.
-				var foundFirstFileName = false
-				var foundSecondFileName = false
-				var foundThirdFileName = false
-				if len(cliContext.Args().Slice()) > 0 {
-					for i := 0; i < len(cliContext.Args().Slice()); i++ {
-						// Incase debug is provided as argument.
-
-						if cliContext.Args().Slice()[i] == "debug" {
-							setDebug(true)
-						} else {
-							if !foundFirstFileName {
-								fullFileNameIPFS = cliContext.Args().Slice()[i]
-								foundFirstFileName = true
-							} else {
-								if !foundSecondFileName {
-									fullFileNameStorj = cliContext.Args().Slice()[i]
-									foundSecondFileName = true
-								} else {
-									if !foundThirdFileName {
-										keyValue = cliContext.Args().Slice()[i]
-										foundThirdFileName = true
-									} else {
-										restrict = cliContext.Args().Slice()[i]
-									}
-								}
-							}
-						}
-					}
-				}
-				// Connect to storj network and it returns context, uplink, project, bucket and storj configration.
-				ctx, uplink, project, bucket, storjConfig, scope, errr := storj.ConnectStorjReadUploadData(fullFileNameStorj, keyValue, restrict)
-				if errr != nil {
-					fmt.Println(errr)
+				// process arguments - Reading the flags or the deprecated positional arguments.
+				options, err := readOptions(cliContext, storeOptions)
+				if err != nil {
+					return usageError(err)
 				}
-				var encryptChunkCID string
-				var fileNamesDEBUG []string
-				var lastFileName string
-
-				// Establish connection with IPFS and get io.Reader implementor.
-				ipfsData, err := ipfs.ConnectToIPFSStorj(fullFileNameIPFS)
 
+				// Read the Storj configuration and the data to store from the IPFS configuration.
+				ctx := cliContext.Context
+				logger := logging.FromContext(ctx)
+				storjConfig, err := storj.LoadStorjConfiguration(options.storjConfig, logger)
 				if err != nil {
-					log.Fatalf("Failed to establish connection with IPFS: %s\n", err)
+					return fmt.Errorf("loadStorjConfiguration: %w", err)
 				}
-
+				ipfsData, err := ipfs.ConnectToIPFSStorj(ctx, options.ipfsConfig, options.chunkSize)
 				if err != nil {
-					log.Fatalf("IPFS.FetchData: %s", err)
-				} else {
-					fmt.Println("Reading ALL content from the IPFS File: Complete!")
+					return fmt.Errorf("Failed to establish connection with IPFS: %w", err)
 				}
-
-				fmt.Println("\nReading content from the file:", ipfsData.FilePath)
-
-				// Get file name from the file path from configration file.
-				_, lastFileName = filepath.Split(ipfsData.FilePath)
-
-				// Create encrypt Base CID
-				encryptCID, _ := ipfsData.Sh.Add(ipfsData.FileHandle, shell.OnlyHash(true))
-
-				// Close the uploaded file
-				ipfsData.FileHandle.Close()
-
-				// Open the uploaded file
-				file, err1 := os.Open(ipfsData.FilePath)
-				if err1 != nil {
-					fmt.Println(err1)
+				if ipfsData.FileHandle != nil {
+					defer ipfsData.FileHandle.Close()
 				}
-
-				// Get total size of uploaded file
-				statFile, err4 := file.Stat()
-				if err4 != nil {
-					fmt.Println(err4)
+				client, err := newClient(ipfsData, storjConfig, options)
+				if err != nil {
+					return err
 				}
-				fileSize := statFile.Size()
-
-				// Generate the number of chunk files
-				noOfChunkFiles := int(fileSize/ipfsData.ChunkSize) + 1
-
-				// Divided total uploaded file data into chunks DAG.
-				chunkFile := chunker.NewSizeSplitter(file, ipfsData.ChunkSize)
-
-				var metaFile *os.File
-				metaFileName := "./metadata.txt"
-				os.Remove(metaFileName)
-				var uploadStatus bool
-
-				for i := 0; i < noOfChunkFiles; i++ {
-
-					// Get the chunks data from the chunks DAG.
-					storeChunkFile, _ := chunkFile.NextBytes()
-
-					//Encrypt the chunk data by the given key
-					key := []byte("This is a storj ipfs private key")
-					encryptData, err := encrypt(key, storeChunkFile)
 
+				dataOptions := connector.StoreOptions{Resume: options.resume}
+				var result *connector.StoreResult
+				if ipfsData.DAG != "" {
+					// A DAG is stored as a CAR archive, so its root is the base CID
+					// and every block keeps its CID when it is restored.
+					logger.Info("Exporting DAG from IPFS", logging.Any("dag", ipfsData.DAG))
+					result, err = client.StoreDAG(ctx, ipfsData.DAG, dataOptions)
+				} else {
+					logger.Info("Reading content from the file", logging.Any("path", ipfsData.FilePath))
+					var statFile os.FileInfo
+					statFile, err = ipfsData.FileHandle.Stat()
 					if err != nil {
-						log.Fatal(err)
-					}
-
-					// Create chunk CID using bytes data
-					encryptChunkCID, _ = ipfs.CreateCID(ipfsData, encryptData)
-
-					fileName := encryptCID + "/" + encryptChunkCID
-
-					// Upload chunk data on storj Network with baseCID/chunkCID name.
-					fileNamesDEBUG, uploadStatus = storj.ConnectUpload(ctx, bucket, encryptData, fileName, fileNamesDEBUG, storjConfig, errr)
-
-					if uploadStatus != true {
-						fmt.Println("Upload data to IPFS failed.")
-						// Close the storj project.
-						storj.CloseProject(uplink, project, bucket)
-						return errr
+						return err
 					}
-
-					// Write all chunks CID into loacl disk file in append mode.
-					metaFile, _ = os.OpenFile(metaFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-					if _, err := metaFile.WriteString(encryptChunkCID + ","); err != nil {
-						log.Fatal(err)
+					if statFile.IsDir() {
+						// A directory is stored as a whole, with every file below it listed in the manifest.
+						result, err = client.StoreDirectory(ctx, ipfsData.FilePath, dataOptions)
+					} else {
+						// Get file name from the file path from configration file.
+						_, dataOptions.Name = filepath.Split(filepath.Clean(ipfsData.FilePath))
+						dataOptions.Mode = statFile.Mode()
+						dataOptions.ModTime = statFile.ModTime()
+						dataOptions.Archive = ipfsData.IsArchive()
+						result, err = client.Store(ctx, ipfsData.FileHandle, dataOptions)
 					}
-					// Close meta file after write all chunks into the file
-					metaFile.Close()
+				}
+				if err != nil {
+					return err
 				}
 
-				// Open meta file from local disk
-				openMetaFile, _ := os.Open(metaFileName)
-				metadataBytes, _ := ioutil.ReadAll(openMetaFile)
-				// Close Meta file
-				openMetaFile.Close()
-				// Remove meta file from local disk.
-				os.Remove(metaFileName)
-
-				metaFileStoreName := encryptCID + "/" + encryptCID + ".txt"
-
-				// Store meta file data on storj network with baseCID/baseCID.txt
-				storj.ConnectUpload(ctx, bucket, metadataBytes, metaFileStoreName, fileNamesDEBUG, storjConfig, errr)
-				// Debug the storj data.
-				storj.Debug(bucket, metaFileStoreName, storjConfig, lastFileName)
-
-				// Close the storj project.
-				storj.CloseProject(uplink, project, bucket)
-
-				fmt.Println("\nAdding configuration data to IPFS: Initiated...")
-
-				// Get the configration data of storj
-				configStorj, _ := storj.LoadStorjConfiguration(fullFileNameStorj)
+				printShareableHash(options, result)
+				return nil
+			},
+		},
+		{
+			Name:      "pinset",
+			Aliases:   []string{"p"},
+			Usage:     "Command to back up every DAG pinned on a desired IPFS instance to given Storj Bucket.",
+			UsageText: "storj-ipfs pinset [--ipfs-config FILE] [--storj-config FILE] [--auth key|scope] [--restrict] [--chunk-size BYTES] [--resume] [--debug]\n\n   The path and DAG of the IPFS configuration are not used.\n   Deprecated: storj-ipfs pinset [ipfsConfig] [storjConfig] [key] [restrict] [resume] [debug]",
+			Flags:     storeFlags(),
+			Action: func(cliContext *cli.Context) error {
 
-				checkSlash := configStorj.UploadPath[len(configStorj.UploadPath)-1:]
-				if checkSlash != "/" {
-					configStorj.UploadPath = configStorj.UploadPath + "/"
+				// process arguments - Reading the flags or the deprecated positional arguments.
+				options, err := readOptions(cliContext, storeOptions)
+				if err != nil {
+					return usageError(err)
 				}
-				ipfsStorjData := configStorj.Bucket + "," + configStorj.UploadPath + "," + lastFileName
 
-				//Encrypt the storj configration data
-				enkey := []byte(configStorj.Key)
+				storjConfig, err := storj.LoadStorjConfiguration(options.storjConfig, logging.FromContext(cliContext.Context))
+				if err != nil {
+					return fmt.Errorf("loadStorjConfiguration: %w", err)
+				}
+				// Establish connection with IPFS, without a file to upload.
+				ipfsData, err := ipfs.ConnectToIPFSNode(cliContext.Context, options.ipfsConfig, options.chunkSize)
+				if err != nil {
+					return fmt.Errorf("Failed to establish connection with IPFS: %w", err)
+				}
+				client, err := newClient(ipfsData, storjConfig, options)
+				if err != nil {
+					return err
+				}
 
-				ipfsStorjDataBytes := []byte(ipfsStorjData)
-				storjEncryptData, err := encrypt(enkey, ipfsStorjDataBytes)
+				// Export every pinned DAG and upload it as a CAR archive.
+				result, err := client.StorePinset(cliContext.Context, connector.StoreOptions{Resume: options.resume})
 				if err != nil {
-					log.Fatal(err)
+					return err
 				}
 
-				var hash []byte
-				hash = []byte(encryptCID)
+				printShareableHash(options, result)
+				return nil
+			},
+		},
+		{
+			Name:      "download",
+			Aliases:   []string{"d"},
+			Usage:     "Command to connect and downlaod  ALL files from a desired IPFS instance to given Storj Bucket.",
+			UsageText: "storj-ipfs download [--ipfs-config FILE] [--auth key|scope] [--output DIR] [--debug]\n\n   Deprecated: storj-ipfs download [downloadConfig] [key] [debug]",
+			Flags:     downloadFlags(true),
+			Action: func(cliContext *cli.Context) error {
 
-				// Create buffer for Chunk CID and encrypted Storj configurations.
-				var encryptedStorjConfig []byte
-				encryptedStorjConfig = append(hash, storjEncryptData...)
+				// process arguments - Reading the flags or the deprecated positional arguments.
+				options, err := readOptions(cliContext, downloadOptions)
+				if err != nil {
+					return usageError(err)
+				}
 
-				// Create the CID from encrypted chunk data and encrypted
-				// storj configration and enrypted private key.
-				sh := ipfsData.Sh
-				configHash, _ := sh.Add(bytes.NewReader(encryptedStorjConfig))
+				// Read Configration from file
+				downloadConfigStorj, err := storj.DownloadStorjConfiguration(options.ipfsConfig, logging.FromContext(cliContext.Context))
+				if err != nil {
+					return fmt.Errorf("loadStorjConfiguration: %w", err)
+				}
+				if options.output != "" {
+					downloadConfigStorj.DownloadPath = options.output
+				}
+				client, err := newDownloadClient(downloadConfigStorj, options)
+				if err != nil {
+					return err
+				}
 
-				fmt.Println("Adding configuration data to IPFS: Complete!")
-				fmt.Println(" ")
-				if keyValue == "key" {
-					if restrict == "restrict" {
-						fmt.Println("Restricted Serialized Scope Key: ", scope)
-						fmt.Println(" ")
-					} else {
-						fmt.Println("Serialized Scope Key: ", scope)
-						fmt.Println(" ")
-					}
+				// Download file from storj and save to local disk
+				fileName, err := client.Download(cliContext.Context, downloadConfigStorj.FileHash, downloadConfigStorj.DownloadPath)
+				if err != nil {
+					return err
 				}
-				fmt.Println("Shareable Hash:", configHash)
-				return err
+				// Like every command result, this is printed on stdout, not logged.
+				fmt.Printf("\nFile \"%s\" downloaded to \"%s\"\n", fileName, downloadConfigStorj.DownloadPath)
+				return nil
 			},
 		},
 		{
-			Name:    "download",
-			Aliases: []string{"d"},
-			Usage:   "Command to connect and downlaod  ALL files from a desired IPFS instance to given Storj Bucket.",
-			//\n arguments- 1. fileName [optional] = provide full file name (with complete path), storing Storj configuration information if this fileName is not given, then data is read from ./config/ipfs_download.json example = ./storj-ipfs d ./config/ipfs_download.json\n\n\n",
+			Name:      "restore",
+			Aliases:   []string{"r"},
+			Usage:     "Command to restore data stored on Storj back into a desired IPFS instance and pin it.",
+			UsageText: "storj-ipfs restore [--ipfs-config FILE] [--auth key|scope] [--debug]\n\n   The downloadPath of the download configuration is not used.\n   Deprecated: storj-ipfs restore [downloadConfig] [key] [debug]",
+			Flags:     downloadFlags(false),
 			Action: func(cliContext *cli.Context) error {
 
-				// Default Storj configuration file name.
-				var downloadedFullFileName = iPFSDownloadFile
-				var foundFirstFileName = false
-				var keyValue string
-				// process arguments
-				if len(cliContext.Args().Slice()) > 0 {
-					for i := 0; i < len(cliContext.Args().Slice()); i++ {
-
-						// Incase, debug is provided as argument.
-						if cliContext.Args().Slice()[i] == "debug" {
-							setDebug(true)
-						} else {
-							if !foundFirstFileName {
-								downloadedFullFileName = cliContext.Args().Slice()[i]
-								foundFirstFileName = true
-							} else {
-								keyValue = cliContext.Args().Slice()[i]
-							}
-						}
-					}
+				// process arguments - Reading the flags or the deprecated positional arguments.
+				options, err := readOptions(cliContext, downloadOptions)
+				if err != nil {
+					return usageError(err)
 				}
 
 				// Read Configration from file
-				downloadConfigStorj, err := storj.DownloadStorjConfiguration(downloadedFullFileName)
+				downloadConfigStorj, err := storj.DownloadStorjConfiguration(options.ipfsConfig, logging.FromContext(cliContext.Context))
 				if err != nil {
-					fmt.Println("loadStorjConfiguration: ", err)
+					return fmt.Errorf("loadStorjConfiguration: %w", err)
 				}
-
-				// Connect and read data from IPFS using file hash and return io.Reader
-				reader, err1 := ipfs.ConnectToIPFSForDownload(downloadConfigStorj.FileHash, downloadConfigStorj.HostName, downloadConfigStorj.Port)
-				if err1 != nil {
-					log.Fatalf("Failed to establish connection with IPFS: %s\n", err1)
+				client, err := newDownloadClient(downloadConfigStorj, options)
+				if err != nil {
+					return err
 				}
 
-				// Download file from storj and save to local disk
-				storj.ConnectStorjReadDownloadData(downloadConfigStorj, reader, keyValue)
-				return err
+				// Add the data back into the IPFS node, pin it and verify its CID.
+				baseCID, err := client.Restore(cliContext.Context, downloadConfigStorj.FileHash)
+				if err != nil {
+					return err
+				}
+				// Print the restored CID on stdout, for scripts to read.
+				fmt.Println("\nRestore to IPFS: Complete!")
+				fmt.Println("Restored CID:", baseCID)
+				return nil
 			},
 		},
 	}
 }
 
+// testArguments reads the arguments of the test command:
+// the Storj configuration file, "key" and "restrict", and the "debug" keyword anywhere.
+func testArguments(args []string) (fullFileName string, key string, restrict string, debug bool) {
+	// Default Storj configuration file name.
+	fullFileName = storjConfigFile
+
+	var foundFirstFileName = false
+	var foundSecondFileName = false
+	for i := 0; i < len(args); i++ {
+		// Incase, debug is provided as argument.
+		if args[i] == "debug" {
+			debug = true
+		} else {
+			if !foundFirstFileName {
+				fullFileName = args[i]
+				foundFirstFileName = true
+			} else {
+				if !foundSecondFileName {
+					key = args[i]
+					foundSecondFileName = true
+				} else {
+					restrict = args[i]
+				}
+			}
+		}
+	}
+	return fullFileName, key, restrict, debug
+}
+
+// downloadArguments reads the arguments of the download and restore commands:
+// the download configuration file and "key", and the "debug" keyword anywhere.
+func downloadArguments(args []string) (downloadedFullFileName string, keyValue string, debug bool) {
+	// Default Storj configuration file name.
+	downloadedFullFileName = iPFSDownloadFile
+
+	var foundFirstFileName = false
+	for i := 0; i < len(args); i++ {
+		// Incase, debug is provided as argument.
+		if args[i] == "debug" {
+			debug = true
+		} else {
+			if !foundFirstFileName {
+				downloadedFullFileName = args[i]
+				foundFirstFileName = true
+			} else {
+				keyValue = args[i]
+			}
+		}
+	}
+	return downloadedFullFileName, keyValue, debug
+}
+
+// storeArguments reads the arguments of the store and pinset commands:
+// the IPFS and Storj configuration files, "key" and "restrict",
+// and the "debug" and "resume" keywords anywhere.
+func storeArguments(args []string) (fullFileNameIPFS string, fullFileNameStorj string, keyValue string, restrict string, resume bool, debug bool) {
+	// Default configuration file names.
+	fullFileNameIPFS = ipfsConfigFile
+	fullFileNameStorj = storjConfigFile
+
+	var foundFirstFileName = false
+	var foundSecondFileName = false
+	var foundThirdFileName = false
+	for i := 0; i < len(args); i++ {
+		// Incase debug is provided as argument.
+		if args[i] == "debug" {
+			debug = true
+		} else if args[i] == "resume" {
+			// Incase resume is provided as argument.
+			resume = true
+		} else {
+			if !foundFirstFileName {
+				fullFileNameIPFS = args[i]
+				foundFirstFileName = true
+			} else {
+				if !foundSecondFileName {
+					fullFileNameStorj = args[i]
+					foundSecondFileName = true
+				} else {
+					if !foundThirdFileName {
+						keyValue = args[i]
+						foundThirdFileName = true
+					} else {
+						restrict = args[i]
+					}
+				}
+			}
+		}
+	}
+	return fullFileNameIPFS, fullFileNameStorj, keyValue, restrict, resume, debug
+}
+
+// newClient returns the client storing data with the Storj configuration and the settings
+// of the IPFS configuration, accessing Storj as the command options say.
+func newClient(ipfsData *ipfs.IPFSdata, storjConfig storj.ConfigStorj, options commandOptions) (*connector.Client, error) {
+	return connector.NewClient(ipfsData.Node, connector.Config{
+		Storj:      storjConfig,
+		UseAPIKey:  options.keyValue == "key",
+		Restrict:   options.restrict == "restrict",
+		Chunker:    ipfsData.Chunker,
+		CIDVersion: ipfsData.CIDVersion,
+		Verify:     options.debug,
+	})
+}
+
+// newDownloadClient returns the client reading the shareable hash of the download configuration
+// from its IPFS instance, accessing Storj as the command options say.
+func newDownloadClient(downloadConfigStorj storj.DownloadConfigStorj, options commandOptions) (*connector.Client, error) {
+	if downloadConfigStorj.HostName == "ipfsHostName" || downloadConfigStorj.HostName == "" {
+		return nil, errs.New(errs.ErrConfigInvalid, "Invalid HostName")
+	}
+	ipfsTimeout, err := timeouts.Parse(downloadConfigStorj.IPFSTimeout)
+	if err != nil {
+		return nil, err
+	}
+	node := ipfs.NodeWithTimeout(ipfs.NewHTTPNode(downloadConfigStorj.HostName+":"+downloadConfigStorj.Port), ipfsTimeout)
+	return connector.NewClient(node, connector.Config{
+		Storj:     downloadConfigStorj.StorjConfig(),
+		UseAPIKey: options.keyValue == "key",
+	})
+}
+
+// printShareableHash shows the shareable hash, and the serialized scope key when one was created.
+// They are the result of the command, written to stdout for the user or a script to read,
+// while the log records go to stderr. The scope key is a secret the user asked for, so it
+// is printed here and never logged.
+func printShareableHash(options commandOptions, result *connector.StoreResult) {
+	fmt.Println(" ")
+	if options.keyValue == "key" {
+		if options.restrict == "restrict" {
+			fmt.Println("Restricted Serialized Scope Key: ", result.Scope)
+			fmt.Println(" ")
+		} else {
+			fmt.Println("Serialized Scope Key: ", result.Scope)
+			fmt.Println(" ")
+		}
+	}
+	fmt.Println("Shareable Hash:", result.Hash)
+}
+
 func main() {
 
 	// Show application information on screen
 	setAppInfo()
 	// Get command entered by user on cli
 	setCommands()
-	// Get detailed information for debugging
-	setDebug(false)
+	// Log to stderr, as set by the --log-level and --log-format flags.
+	logger := logging.New(os.Stderr, logging.LevelInfo, logging.FormatText)
+	setLogging(logger)
 
-	err := app.Run(os.Args)
+	// Interrupting a command cancels it, so the bucket is closed and the upload journal kept.
+	ctx, stop := interruptContext(logger)
+	err := app.RunContext(logging.NewContext(ctx, logger), os.Args)
+	stop()
 
 	if err != nil {
-		log.Fatalf("app.Run: %s", err)
-	}
-}
-
-// Encrypt Function to encrypt data with specified key
-func encrypt(key, text []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-	b := base64.StdEncoding.EncodeToString(text)
-	ciphertext := make([]byte, aes.BlockSize+len(b))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return nil, err
+		logger.Error("Command failed", logging.Err(err))
+		if errors.Is(err, context.Canceled) {
+			logger.Warn("Interrupted: run the command again to continue (with --resume for store and pinset).")
+		}
+		os.Exit(exitCode(err))
 	}
-	cfb := cipher.NewCFBEncrypter(block, iv)
-	cfb.XORKeyStream(ciphertext[aes.BlockSize:], []byte(b))
-	return ciphertext, nil
 }
@@ -0,0 +1,180 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package connector stores data from IPFS on the Storj network and fetches it back
+// through the shareable hashes it publishes on IPFS. Its methods return errors
+// instead of exiting, so it can be embedded in other programs.
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	errs "storj-ipfs/errs"
+	ipfs "storj-ipfs/ipfs"
+	logging "storj-ipfs/logging"
+	storj "storj-ipfs/storj"
+	timeouts "storj-ipfs/timeouts"
+)
+
+// Config configures a Client.
+type Config struct {
+	// Storj holds the credentials, the bucket and upload path data is stored in,
+	// the secret key and the cipher, concurrency, dedup, timeout and retry settings.
+	// Fetching only needs the credentials, the secret key, the concurrency, the timeouts and the retry settings.
+	Storj storj.ConfigStorj
+	// UseAPIKey accesses Storj with the API key, satellite and encryption passphrase
+	// instead of the serialized scope key, and returns the scope key to share with a stored hash.
+	UseAPIKey bool
+	// Restrict shares a scope key restricted by the disallow settings. It needs UseAPIKey.
+	Restrict bool
+	// Chunker is the go-ipfs-chunker setting data is split with; empty means chunks of ipfs.DefaultChunkSize.
+	Chunker string
+	// CIDVersion is the version of the CIDs computed for stored data, 0 or 1.
+	CIDVersion int
+	// JournalDir is the directory upload journals are kept in; empty means storj.DefaultJournalDir.
+	JournalDir string
+	// Store, if set, is used instead of the Storj bucket, e.g. a storj.DirStore.
+	Store storj.ObjectStore
+	// Verify downloads stored data again into the debug folder, to check it can be read back.
+	Verify bool
+	// Logger, if set, receives the progress of every method, instead of the logger of its context.
+	// Secrets are never logged.
+	Logger *logging.Logger
+}
+
+// Kinds of failure wrapped by the errors of Client, to be told apart with errors.Is.
+// They are the kinds of package errs, which the ipfs and storj packages report too.
+var (
+	ErrDaemonUnavailable = errs.ErrDaemonUnavailable
+	ErrInvalidHash       = errs.ErrInvalidHash
+	ErrAccessDenied      = errs.ErrAccessDenied
+	ErrDecrypt           = errs.ErrDecrypt
+	ErrChunkMissing      = errs.ErrChunkMissing
+	ErrConfigInvalid     = errs.ErrConfigInvalid
+)
+
+// Client stores data on Storj and publishes shareable hashes of it on an IPFS node.
+// Its methods log to Config.Logger, or else to the logger of their context, if any.
+// They stop when their context is done, closing the bucket they opened.
+// A store stopped that way keeps its upload journal, so it can be resumed.
+type Client struct {
+	node        ipfs.ContentNode
+	config      Config
+	algorithm   storj.Algorithm
+	concurrency int
+	// connectTimeout and objectTimeout bound opening the bucket and each object operation.
+	connectTimeout time.Duration
+	objectTimeout  time.Duration
+	// retry retries each object operation failing with a transient error.
+	retry storj.RetryPolicy
+}
+
+// Error is the error returned by Client: the operation that failed and why.
+// It is not an errs.Error, which has a single kind: it records the operation of any error,
+// including the ones of no kind, such as a failed write, and leaves the kind to its cause,
+// where errors.Is and errors.As find it.
+type Error struct {
+	// Op is the failed operation: "config", "store", "fetch", "download" or "restore".
+	Op  string
+	Err error
+}
+
+// Error returns the operation and the message of its cause.
+func (err *Error) Error() string {
+	return err.Op + ": " + err.Err.Error()
+}
+
+// Unwrap returns the cause of the error.
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// wrapError wraps the error *err, if any, in an Error of op.
+func wrapError(op string, err *error) {
+	if *err != nil {
+		*err = &Error{Op: op, Err: *err}
+	}
+}
+
+// NewClient returns a client publishing on and reading shareable hashes from node,
+// after validating config.
+func NewClient(node ipfs.ContentNode, config Config) (client *Client, err error) {
+	defer wrapError("config", &err)
+
+	if config.Chunker == "" {
+		config.Chunker = "size-" + strconv.Itoa(ipfs.DefaultChunkSize)
+	}
+	if err := storj.ValidateChunker(config.Chunker); err != nil {
+		return nil, err
+	}
+	if config.CIDVersion != 0 && config.CIDVersion != 1 {
+		return nil, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("unsupported CID version %d", config.CIDVersion))
+	}
+	if config.Restrict && !config.UseAPIKey {
+		return nil, errs.New(errs.ErrConfigInvalid, "a restricted scope key needs the API key")
+	}
+	if config.JournalDir == "" {
+		config.JournalDir = storj.DefaultJournalDir
+	}
+
+	// Cipher used to seal the chunks and the configuration data.
+	algorithm, err := storj.ParseAlgorithm(config.Storj.Cipher)
+	if err != nil {
+		return nil, err
+	}
+	// Number of chunks encrypted and transferred at once.
+	concurrency, err := storj.ParseConcurrency(config.Storj.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+	connectTimeout, err := timeouts.Parse(config.Storj.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	objectTimeout, err := timeouts.Parse(config.Storj.ObjectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	retry, err := storj.ParseRetryPolicy(config.Storj.RetryAttempts, config.Storj.RetryDeadline)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		node:           node,
+		config:         config,
+		algorithm:      algorithm,
+		concurrency:    concurrency,
+		connectTimeout: connectTimeout,
+		objectTimeout:  objectTimeout,
+		retry:          retry,
+	}, nil
+}
+
+// withLogger returns ctx carrying the configured logger, if any, for the ipfs and storj packages.
+func (client *Client) withLogger(ctx context.Context) context.Context {
+	if client.config.Logger == nil {
+		return ctx
+	}
+	return logging.NewContext(ctx, client.config.Logger)
+}
+
+// connect opens bucket within the connect timeout, creating it if create is set,
+// or wraps the configured store. Every object operation is bounded by the object timeout.
+func (client *Client) connect(ctx context.Context, bucket string, create bool) (*storj.Connection, error) {
+	if client.config.Store != nil {
+		return &storj.Connection{Store: storj.StoreWithTimeout(client.config.Store, client.objectTimeout)}, nil
+	}
+
+	connectCtx, cancel := storj.WithTimeout(ctx, client.connectTimeout)
+	defer cancel()
+	connection, err := storj.Connect(connectCtx, client.config.Storj.Access(client.config.UseAPIKey), bucket, create)
+	if err != nil {
+		return nil, err
+	}
+	connection.Store = storj.StoreWithTimeout(connection.Store, client.objectTimeout)
+	return connection, nil
+}
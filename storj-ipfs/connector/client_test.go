@@ -0,0 +1,45 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	errs "storj-ipfs/errs"
+)
+
+func TestError(t *testing.T) {
+	for _, kind := range []error{ErrDaemonUnavailable, ErrInvalidHash, ErrAccessDenied, ErrDecrypt, ErrChunkMissing, ErrConfigInvalid} {
+		for name, cause := range map[string]error{
+			"new":     errs.New(kind, "message"),
+			"wrap":    errs.Wrap(kind, os.ErrNotExist, "message"),
+			"wrapped": fmt.Errorf("context: %w", errs.Wrap(kind, os.ErrNotExist, "message")),
+		} {
+			var err error = &Error{Op: "store", Err: cause}
+			if !errors.Is(err, kind) {
+				t.Errorf("%v %s: not of its kind", kind, name)
+			}
+			var kindErr *errs.Error
+			if !errors.As(err, &kindErr) || kindErr.Kind != kind {
+				t.Errorf("%v %s: kind not found", kind, name)
+			}
+			var opErr *Error
+			if !errors.As(fmt.Errorf("command: %w", err), &opErr) || opErr.Op != "store" {
+				t.Errorf("%v %s: operation not found", kind, name)
+			}
+		}
+	}
+
+	// Errors of no kind keep their cause.
+	err := &Error{Op: "download", Err: fmt.Errorf("could not write: %w", os.ErrPermission)}
+	if !errors.Is(err, os.ErrPermission) || errors.Is(err, ErrAccessDenied) {
+		t.Errorf("%v: wrong cause", err)
+	}
+	if message := err.Error(); message != "download: could not write: "+os.ErrPermission.Error() {
+		t.Errorf("message %q", message)
+	}
+}
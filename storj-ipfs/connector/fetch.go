@@ -0,0 +1,195 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package connector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	ipfs "storj-ipfs/ipfs"
+	logging "storj-ipfs/logging"
+	storj "storj-ipfs/storj"
+)
+
+// shared is the data a shareable hash points to, with the bucket holding it.
+type shared struct {
+	connection *storj.Connection
+	pointer    *storj.Pointer
+	config     *storj.PointerConfig
+}
+
+// prefix returns the prefix of the objects of the shared data.
+func (shared *shared) prefix() string {
+	return shared.config.UploadPath + shared.pointer.BaseCID + "/"
+}
+
+// openShared reads the pointer blob of hash from the IPFS node, opens its configuration data
+// with the user's secret and opens the bucket it points to.
+// The caller must close the returned connection.
+func (client *Client) openShared(ctx context.Context, hash string) (*shared, error) {
+	if err := ipfs.ValidateHash(hash); err != nil {
+		return nil, err
+	}
+	reader, err := ipfs.ReadFromNode(ctx, client.node, hash)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading shareable hash data: %w", err)
+	}
+
+	pointer, pointerConfig, err := storj.OpenPointer(blob, client.config.Storj.Key)
+	if err != nil {
+		return nil, err
+	}
+	connection, err := client.connect(ctx, pointerConfig.Bucket, false)
+	if err != nil {
+		return nil, err
+	}
+	return &shared{connection: connection, pointer: pointer, config: pointerConfig}, nil
+}
+
+// Fetch writes the file the shareable hash points to to w, downloading and verifying
+// its chunks one at a time in order. Stored directories and pinsets can only be downloaded.
+func (client *Client) Fetch(ctx context.Context, hash string, w io.Writer) (err error) {
+	defer wrapError("fetch", &err)
+	ctx = client.withLogger(ctx)
+
+	shared, err := client.openShared(ctx, hash)
+	if err != nil {
+		return err
+	}
+	defer shared.connection.Close()
+
+	manifest, err := storj.ReadManifest(ctx, shared.connection.Store, shared.config.UploadPath, shared.pointer.BaseCID)
+	if err != nil {
+		return err
+	}
+	if manifest.Directory {
+		return fmt.Errorf("%s is a stored directory, which can only be downloaded", hash)
+	}
+
+	data := storj.StreamChunks(ctx, shared.connection.Store, manifest.Chunks, shared.prefix(), shared.config.DataKey, client.retry)
+	defer data.Close()
+	if _, err := io.Copy(w, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Download downloads the data the shareable hash points to into localPath, creating it if needed,
+// and returns the name it was downloaded as. Stored directories are recreated with all their files.
+// An interrupted download is resumed by downloading the same hash again.
+func (client *Client) Download(ctx context.Context, hash string, localPath string) (fileName string, err error) {
+	defer wrapError("download", &err)
+	ctx = client.withLogger(ctx)
+
+	shared, err := client.openShared(ctx, hash)
+	if err != nil {
+		return "", err
+	}
+	defer shared.connection.Close()
+
+	// Create directory if not present
+	if err := os.MkdirAll(localPath, 0755); err != nil {
+		return "", fmt.Errorf("Invalid Download Path: %w", err)
+	}
+
+	err = storj.DownloadData(ctx, shared.connection.Store, localPath, shared.config.UploadPath, shared.pointer.BaseCID, shared.config.FileName, shared.config.DataKey, client.concurrency, client.retry)
+	if err != nil {
+		return "", err
+	}
+	return shared.config.FileName, nil
+}
+
+// Restore adds the data the shareable hash points to back into the IPFS node and pins it,
+// checking it against the CIDs recorded when it was stored, and returns its base CID.
+// A stored DAG is imported from its CAR archive, and a stored pinset DAG by DAG
+// with the original pin types. Stored directories can only be downloaded.
+func (client *Client) Restore(ctx context.Context, hash string) (baseCID string, err error) {
+	defer wrapError("restore", &err)
+	ctx = client.withLogger(ctx)
+
+	shared, err := client.openShared(ctx, hash)
+	if err != nil {
+		return "", err
+	}
+	defer shared.connection.Close()
+
+	if err := client.restore(ctx, shared); err != nil {
+		return "", err
+	}
+	return shared.pointer.BaseCID, nil
+}
+
+// restore adds the shared data back into the IPFS node and pins it.
+func (client *Client) restore(ctx context.Context, shared *shared) error {
+	store := shared.connection.Store
+	baseCID := shared.pointer.BaseCID
+	prefix := shared.prefix()
+
+	manifest, err := storj.ReadManifest(ctx, store, shared.config.UploadPath, baseCID)
+	if err != nil {
+		return err
+	}
+
+	if len(manifest.Pins) > 0 {
+		// The base CID of a pinset is the CID of its listing of pins.
+		listingCID, err := ipfs.ComputeCID(bytes.NewReader(storj.PinsetListing(manifest.Pins)), ipfs.CIDVersion(baseCID))
+		if err != nil {
+			return err
+		}
+		if !ipfs.SameCID(listingCID, baseCID) {
+			return fmt.Errorf("pinset manifest does not match base CID %s", baseCID)
+		}
+
+		entries := make(map[string]storj.ManifestEntry, len(manifest.Entries))
+		for _, entry := range manifest.Entries {
+			entries[entry.Path] = entry
+		}
+		for _, pin := range manifest.Pins {
+			entry, ok := entries[pin.Path]
+			if !ok {
+				return fmt.Errorf("pinset manifest has no archive for %s", pin.CID)
+			}
+			fileKey, err := storj.FileKey(shared.config.DataKey, entry.Path)
+			if err != nil {
+				return err
+			}
+
+			logger := logging.FromContext(ctx).With(logging.Any("cid", pin.CID))
+			logger.Info("Restoring pin", logging.Any("type", pin.Type))
+			archive := storj.StreamChunks(ctx, store, entry.Chunks, prefix, fileKey, client.retry)
+			err = ipfs.RestoreDAG(ctx, client.node, archive, pin.CID, pin.Type)
+			archive.Close()
+			if err != nil {
+				return err
+			}
+			logger.Info("Restored pin")
+		}
+		return nil
+	}
+
+	if manifest.Directory {
+		return errors.New("stored directories can only be downloaded, not restored to IPFS")
+	}
+
+	// A stored DAG is imported from its CAR archive, keeping the CID of every block.
+	if manifest.Archive == storj.ArchiveCAR {
+		archive := storj.StreamChunks(ctx, store, manifest.Chunks, prefix, shared.config.DataKey, client.retry)
+		defer archive.Close()
+		return ipfs.RestoreDAG(ctx, client.node, archive, baseCID, ipfs.RecursivePin)
+	}
+
+	// The base CID of a file is the CID the node gives its content.
+	data := storj.StreamChunks(ctx, store, manifest.Chunks, prefix, shared.config.DataKey, client.retry)
+	defer data.Close()
+	return ipfs.RestoreFile(ctx, client.node, data, baseCID)
+}
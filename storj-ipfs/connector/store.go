@@ -0,0 +1,477 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package connector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	errs "storj-ipfs/errs"
+	ipfs "storj-ipfs/ipfs"
+	logging "storj-ipfs/logging"
+	storj "storj-ipfs/storj"
+)
+
+// PinsetFileName is the name a backed up pinset is downloaded as.
+const PinsetFileName = "ipfs-pinset"
+
+// StoreOptions configures a store.
+type StoreOptions struct {
+	// Name is the name the data is downloaded as.
+	Name string
+	// Mode and ModTime are restored on download; zero values record 0644 and the time of the store.
+	Mode    os.FileMode
+	ModTime time.Time
+	// Archive stores the data as a CAR archive with a single root, which becomes the base CID,
+	// so restoring it imports the archive and keeps the CID of every block.
+	Archive bool
+	// Resume resumes the interrupted store of the same data recorded in its upload journal.
+	Resume bool
+}
+
+// StoreResult describes stored data.
+type StoreResult struct {
+	// Hash is the shareable hash of the pointer published on IPFS.
+	Hash string
+	// BaseCID is the CID the data is stored under, as the IPFS node would add it.
+	BaseCID string
+	// Scope is the serialized scope key to share with the hash when the API key is used.
+	Scope string
+	// Size is the size of the stored data.
+	Size int64
+}
+
+// Store stores the data read from data as a file and publishes its shareable hash.
+// Data that is not an io.ReaderAt that can seek is spooled to a temporary file first,
+// as it is read for its base CID and then every chunk is read three times to upload it:
+// for its digest, for the CID of its envelope and to store the envelope.
+func (client *Client) Store(ctx context.Context, data io.Reader, options StoreOptions) (result *StoreResult, err error) {
+	defer wrapError("store", &err)
+	ctx = client.withLogger(ctx)
+
+	if options.Name == "" {
+		return nil, fmt.Errorf("no file name given")
+	}
+	reader, cleanup, err := seekable(data)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var baseCID string
+	if options.Archive {
+		// The root of the archive is the base CID, so every block keeps its CID when it is restored.
+		version, roots, err := ipfs.ReadCARRoots(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(roots) != 1 {
+			return nil, fmt.Errorf("CAR archive has %d roots, expected 1", len(roots))
+		}
+		logging.FromContext(ctx).Info("Reading CAR archive", logging.Any("carVersion", version), logging.Any("root", roots[0]))
+		baseCID = roots[0]
+	} else {
+		// Create encrypt Base CID locally, as the daemon would add the file.
+		baseCID, err = ipfs.ComputeCID(reader, client.config.CIDVersion)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create base CID: %w", err)
+		}
+	}
+	// Go back to the offset data was read from.
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	manifest := fileManifest(options)
+	return client.upload(ctx, baseCID, options.Name, manifest, options.Resume, func(store storj.ObjectStore, uploadOptions storj.UploadOptions) error {
+		return client.uploadFile(ctx, store, manifest, reader, uploadOptions)
+	})
+}
+
+// StoreDAG stores the DAG rooted at dag, exported from the IPFS node as a CAR archive,
+// and publishes its shareable hash. The name defaults to dag with a ".car" extension.
+func (client *Client) StoreDAG(ctx context.Context, dag string, options StoreOptions) (result *StoreResult, err error) {
+	defer wrapError("store", &err)
+	ctx = client.withLogger(ctx)
+
+	if err := ipfs.ValidateHash(dag); err != nil {
+		return nil, err
+	}
+	if err := ipfs.CheckNode(ctx, client.node); err != nil {
+		return nil, err
+	}
+	if options.Name == "" {
+		options.Name = dag + ".car"
+	}
+	options.Archive = true
+
+	manifest := fileManifest(options)
+	return client.upload(ctx, dag, dag, manifest, options.Resume, func(store storj.ObjectStore, uploadOptions storj.UploadOptions) error {
+		archive, err := client.node.DagExport(ctx, dag)
+		if err != nil {
+			return fmt.Errorf("could not export %s: %w", dag, err)
+		}
+		// The archive is spooled, as each of its chunks is read three times: for its digest, its CID and the upload.
+		source, cleanup, err := storj.Spool(archive)
+		archive.Close()
+		if err != nil {
+			return fmt.Errorf("could not export %s: %w", dag, err)
+		}
+		defer cleanup()
+		return client.uploadFile(ctx, store, manifest, source, uploadOptions)
+	})
+}
+
+// StoreDirectory stores the directory root with every file and directory below it
+// and publishes its shareable hash. The name defaults to the base name of root,
+// and the mode and modification time to those of root.
+func (client *Client) StoreDirectory(ctx context.Context, root string, options StoreOptions) (result *StoreResult, err error) {
+	defer wrapError("store", &err)
+	ctx = client.withLogger(ctx)
+
+	statFile, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !statFile.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	if options.Name == "" {
+		options.Name = filepath.Base(filepath.Clean(root))
+	}
+	if options.Mode == 0 {
+		options.Mode = statFile.Mode().Perm()
+	}
+	if options.ModTime.IsZero() {
+		options.ModTime = statFile.ModTime()
+	}
+
+	entries, err := storj.ScanDirectory(root, logging.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	// Create encrypt Base CID from the listing of the directory.
+	baseCID, err := ipfs.ComputeCID(bytes.NewReader(storj.DirectoryListing(entries)), client.config.CIDVersion)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create base CID: %w", err)
+	}
+
+	manifest := fileManifest(options)
+	manifest.Directory = true
+	manifest.Entries = entries
+	return client.upload(ctx, baseCID, root, manifest, options.Resume, func(store storj.ObjectStore, uploadOptions storj.UploadOptions) error {
+		for _, entry := range entries {
+			manifest.FileSize += entry.Size
+		}
+		return storj.UploadDirectory(ctx, store, root, entries, client.config.Chunker, uploadOptions)
+	})
+}
+
+// StorePinset backs up every DAG pinned recursively or directly on the IPFS node, each as a CAR
+// archive recorded with its pin type, and publishes the shareable hash of the pinset.
+// The name defaults to PinsetFileName.
+func (client *Client) StorePinset(ctx context.Context, options StoreOptions) (result *StoreResult, err error) {
+	defer wrapError("store", &err)
+	ctx = client.withLogger(ctx)
+
+	if err := ipfs.CheckNode(ctx, client.node); err != nil {
+		return nil, err
+	}
+	if options.Name == "" {
+		options.Name = PinsetFileName
+	}
+	if options.Mode == 0 {
+		options.Mode = 0755
+	}
+
+	// Enumerate the recursive and direct pins of the node.
+	pinnedDAGs, err := ipfs.ListPins(ctx, client.node)
+	if err != nil {
+		return nil, err
+	}
+	pins := make([]storj.ManifestPin, 0, len(pinnedDAGs))
+	for _, pinned := range pinnedDAGs {
+		pins = append(pins, storj.ManifestPin{CID: pinned.CID, Type: pinned.Type})
+	}
+	logging.FromContext(ctx).Info("Backing up pinned DAGs", logging.Any("pins", len(pins)))
+
+	// Create encrypt Base CID from the listing of the pinset.
+	baseCID, err := ipfs.ComputeCID(bytes.NewReader(storj.PinsetListing(pins)), client.config.CIDVersion)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create base CID: %w", err)
+	}
+
+	manifest := fileManifest(options)
+	manifest.Directory = true
+	manifest.Pins = pins
+	return client.upload(ctx, baseCID, PinsetFileName, manifest, options.Resume, func(store storj.ObjectStore, uploadOptions storj.UploadOptions) error {
+		// Export every pinned DAG and upload it with baseCID/chunkCID names.
+		entries, err := storj.UploadPinset(ctx, store, manifest.Pins, client.node.DagExport, client.config.Chunker, uploadOptions)
+		if err != nil {
+			return err
+		}
+		manifest.Entries = entries
+		for _, entry := range entries {
+			manifest.FileSize += entry.Size
+		}
+		return nil
+	})
+}
+
+// fileManifest returns the manifest of data stored with options, without its chunks.
+func fileManifest(options StoreOptions) *storj.Manifest {
+	manifest := &storj.Manifest{
+		FileName: options.Name,
+		Mode:     uint32(options.Mode.Perm()),
+		ModTime:  options.ModTime.UTC(),
+	}
+	if manifest.Mode == 0 {
+		manifest.Mode = 0644
+	}
+	if options.ModTime.IsZero() {
+		manifest.ModTime = time.Now().UTC()
+	}
+	if options.Archive {
+		manifest.Archive = storj.ArchiveCAR
+	}
+	return manifest
+}
+
+// uploadFile splits the data read from source with the configured chunker, uploads its chunks
+// and records them and the size of the data in manifest.
+func (client *Client) uploadFile(ctx context.Context, store storj.ObjectStore, manifest *storj.Manifest, source *io.SectionReader, options storj.UploadOptions) error {
+	// Divided total uploaded file data into chunks with the configured chunker.
+	boundaries, err := storj.NewBoundaries(source, client.config.Chunker)
+	if err != nil {
+		return err
+	}
+	manifest.Chunks, err = storj.UploadChunks(ctx, store, source, boundaries, options)
+	if err != nil {
+		return err
+	}
+
+	// The size of an exported archive is only known once it has been read.
+	manifest.FileSize = 0
+	for _, chunk := range manifest.Chunks {
+		manifest.FileSize += chunk.Size
+	}
+	return nil
+}
+
+// upload stores data under baseCID: uploadData uploads its chunks with the given options and
+// completes manifest, which is then stored next to them, and the pointer to it is published on IPFS.
+// source identifies the data in the upload journal, so an interrupted store can be resumed.
+func (client *Client) upload(ctx context.Context, baseCID string, source string, manifest *storj.Manifest, resume bool, uploadData func(store storj.ObjectStore, options storj.UploadOptions) error) (*StoreResult, error) {
+	configStorj := client.config.Storj
+	connection, err := client.connect(ctx, configStorj.Bucket, true)
+	if err != nil {
+		return nil, err
+	}
+	defer connection.Close()
+
+	uploadPrefix := configStorj.UploadPath
+	if !strings.HasSuffix(uploadPrefix, "/") {
+		uploadPrefix += "/"
+	}
+
+	// Journal recording uploaded chunks, keyed by the base CID and upload settings.
+	journalPath := storj.JournalPath(client.config.JournalDir, baseCID, configStorj.Bucket, uploadPrefix, source, client.config.Chunker, configStorj.Cipher)
+	journal := storj.NewJournal(journalPath, baseCID)
+	if resume {
+		journal, err = storj.OpenJournal(journalPath, baseCID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Generate the random key all chunk keys of this data are derived from,
+	// or reuse the key of the interrupted upload being resumed.
+	dataKey, err := client.openDataKey(ctx, journal)
+	if err != nil {
+		return nil, err
+	}
+	dedup, err := client.openDedup(ctx, connection.Store, uploadPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encrypt and upload chunks on storj Network with baseCID/chunkCID name.
+	uploadOptions := storj.UploadOptions{
+		Prefix:      uploadPrefix + baseCID + "/",
+		Algorithm:   client.algorithm,
+		DataKey:     dataKey,
+		Concurrency: client.concurrency,
+		ChunkCID: func(data io.Reader) (string, error) {
+			return ipfs.ComputeCID(data, client.config.CIDVersion)
+		},
+		Journal: journal,
+		Resume:  resume,
+		Dedup:   dedup,
+		Retry:   client.retry,
+	}
+	if err := uploadData(connection.Store, uploadOptions); err != nil {
+		return nil, fmt.Errorf("Upload data to Storj failed: %w", err)
+	}
+	if dedup != nil {
+		// Count the references of this data to its shared chunks.
+		if err := dedup.Save(ctx, connection.Store, baseCID, client.retry); err != nil {
+			return nil, err
+		}
+	}
+
+	// Store the manifest on storj network with baseCID/baseCID.txt
+	manifest.Version = storj.ManifestVersion
+	manifest.Chunker = client.config.Chunker
+	if err := storj.UploadManifest(ctx, connection.Store, uploadPrefix, baseCID, manifest, client.retry); err != nil {
+		return nil, err
+	}
+	// Download the stored data again to verify it.
+	if client.config.Verify {
+		configStorj.UploadPath = uploadPrefix
+		if err := storj.Debug(ctx, connection.Store, storj.MetaFileName(baseCID), configStorj, manifest.FileName, dataKey); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &StoreResult{BaseCID: baseCID, Size: manifest.FileSize}
+	if client.config.UseAPIKey {
+		if client.config.Restrict {
+			result.Scope, err = connection.RestrictedScope(configStorj)
+		} else {
+			result.Scope, err = connection.Scope()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	connection.Close()
+
+	// Publish the pointer blob and get the shareable hash.
+	result.Hash, err = client.publishPointer(ctx, uploadPrefix, baseCID, manifest.FileName, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to add configuration data to IPFS: %w", err)
+	}
+
+	// The store is complete, so there is nothing left to resume.
+	if err := journal.Remove(); err != nil {
+		logging.FromContext(ctx).Warn("Could not remove upload journal", logging.Err(err))
+	}
+	return result, nil
+}
+
+// openDataKey returns the data key of the interrupted upload recorded in journal,
+// or generates the random key all chunk keys are derived from and records it in journal
+// sealed with the user's secret key.
+func (client *Client) openDataKey(ctx context.Context, journal *storj.Journal) ([]byte, error) {
+	if journal.SealedDataKey != nil {
+		dataKey, err := storj.OpenWithPassphrase(client.config.Storj.Key, journal.SealedDataKey)
+		if err != nil {
+			return nil, errs.Wrap(errs.ErrDecrypt, err, "Could not read data key from upload journal")
+		}
+		logging.FromContext(ctx).Info("Resuming upload", logging.Any("uploaded", len(journal.Chunks)))
+		return dataKey, nil
+	}
+
+	dataKey, err := storj.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	sealedDataKey, err := storj.SealWithPassphrase(client.algorithm, client.config.Storj.Key, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := journal.SetDataKey(sealedDataKey); err != nil {
+		return nil, err
+	}
+	return dataKey, nil
+}
+
+// openDedup returns the shared chunks below uploadPrefix when a dedup secret is configured, or nil.
+func (client *Client) openDedup(ctx context.Context, store storj.ObjectStore, uploadPrefix string) (*storj.Dedup, error) {
+	configStorj := client.config.Storj
+	if configStorj.DedupSecret == "" {
+		return nil, nil
+	}
+	secretKey, err := storj.DedupSecretKey(configStorj.DedupSecret, configStorj.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	dedup, err := storj.OpenDedup(ctx, store, uploadPrefix+storj.DedupPrefix, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx).Info("Deduplicating chunks", logging.Any("prefix", dedup.Prefix))
+	return dedup, nil
+}
+
+// publishPointer seals the Storj location of the data stored under uploadPrefix+baseCID and its data key
+// with the user's secret key, and adds the pointer blob to the IPFS node.
+// It returns the shareable hash.
+func (client *Client) publishPointer(ctx context.Context, uploadPrefix string, baseCID string, fileName string, dataKey []byte) (string, error) {
+	logger := logging.FromContext(ctx)
+	logger.Info("Adding configuration data to IPFS")
+
+	// The data key is only stored here, encrypted with the user's secret key.
+	pointerConfig := storj.PointerConfig{
+		Version:    storj.PointerConfigVersion,
+		Bucket:     client.config.Storj.Bucket,
+		UploadPath: uploadPrefix,
+		FileName:   fileName,
+		DataKey:    dataKey,
+	}
+	ipfsStorjDataBytes, err := pointerConfig.Marshal()
+	if err != nil {
+		return "", err
+	}
+
+	//Encrypt the storj configration data with a key derived from the user's secret
+	storjEncryptData, err := storj.SealWithPassphrase(client.algorithm, client.config.Storj.Key, ipfsStorjDataBytes)
+	if err != nil {
+		return "", err
+	}
+
+	// Create self-describing pointer for base CID and encrypted Storj configurations.
+	pointer := storj.Pointer{BaseCID: baseCID, SealedConfig: storjEncryptData}
+
+	// Add the pointer to IPFS and pin it.
+	configHash, err := ipfs.PublishToNode(ctx, client.node, pointer.Marshal())
+	if err != nil {
+		return "", err
+	}
+	logger.Info("Added configuration data to IPFS")
+	return configHash, nil
+}
+
+// readSeekerAt is data that can be read at any offset and knows its size.
+type readSeekerAt interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+// seekable returns a reader over data from its current offset, spooling it to a temporary file
+// if it is not an io.ReaderAt that can seek. The returned function removes the temporary file.
+func seekable(data io.Reader) (*io.SectionReader, func(), error) {
+	if source, ok := data.(readSeekerAt); ok {
+		// Data before the current offset is not stored, so the base CID and chunks start at it.
+		start, err := source.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, nil, err
+		}
+		end, err := source.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := source.Seek(start, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+		return io.NewSectionReader(source, start, end-start), func() {}, nil
+	}
+	return storj.Spool(data)
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package connector
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	ipfs "storj-ipfs/ipfs"
+	storj "storj-ipfs/storj"
+)
+
+// testClient returns a client storing into store and publishing on node,
+// and a function removing its journal directory.
+func testClient(t *testing.T, node ipfs.ContentNode, store storj.ObjectStore) (*Client, func()) {
+	dir, err := ioutil.TempDir("", "storj-ipfs-journal-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(node, Config{
+		Storj:      storj.ConfigStorj{Bucket: "bucket", UploadPath: "uploads", Key: "secret", Concurrency: "2"},
+		Chunker:    "size-1000",
+		JournalDir: dir,
+		Store:      store,
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return client, func() { os.RemoveAll(dir) }
+}
+
+func TestStoreFromOffset(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup := testClient(t, ipfs.NewFakeNode(), storj.NewMemStore())
+	defer cleanup()
+
+	data := make([]byte, 5500)
+	rand.New(rand.NewSource(1)).Read(data)
+	stored := data[1234:]
+
+	// Only the data after the current offset of a reader is stored.
+	reader := bytes.NewReader(data)
+	if _, err := reader.Seek(1234, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.Store(ctx, reader, StoreOptions{Name: "file.bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseCID, err := ipfs.ComputeCID(bytes.NewReader(stored), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BaseCID != baseCID || result.Size != int64(len(stored)) {
+		t.Errorf("stored %d bytes as %s, expected %d bytes as %s", result.Size, result.BaseCID, len(stored), baseCID)
+	}
+
+	var fetched bytes.Buffer
+	if err := client.Fetch(ctx, result.Hash, &fetched); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fetched.Bytes(), stored) {
+		t.Errorf("fetched %d bytes that differ from the %d stored", fetched.Len(), len(stored))
+	}
+}
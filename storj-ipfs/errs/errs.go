@@ -0,0 +1,65 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package errs defines the kinds of failure reported by the ipfs, storj and connector packages.
+// Their errors wrap one of the kinds, so callers can tell them apart with errors.Is,
+// or get the message and the cause with errors.As and an *Error.
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of failure.
+var (
+	// ErrDaemonUnavailable means the IPFS daemon could not be reached.
+	ErrDaemonUnavailable = errors.New("IPFS daemon unavailable")
+	// ErrInvalidHash means a hash is not a CID, or does not point to shareable hash data.
+	ErrInvalidHash = errors.New("invalid hash")
+	// ErrAccessDenied means the Storj credentials were refused or could not open the project or bucket.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrDecrypt means data could not be decrypted or verified: a wrong secret key, or altered data.
+	ErrDecrypt = errors.New("could not decrypt")
+	// ErrChunkMissing means a chunk or the manifest of stored data is missing from the bucket.
+	ErrChunkMissing = errors.New("chunk missing")
+	// ErrConfigInvalid means a configuration file or setting is missing or invalid.
+	ErrConfigInvalid = errors.New("invalid configuration")
+)
+
+// Error is a failure of one of the kinds above, with its own message and cause.
+type Error struct {
+	// Kind is one of the kinds of failure.
+	Kind    error
+	Message string
+	// Err is the cause, if any.
+	Err error
+}
+
+// Error returns the message, followed by the message of the cause if any.
+func (err *Error) Error() string {
+	if err.Err == nil {
+		return err.Message
+	}
+	return err.Message + ": " + err.Err.Error()
+}
+
+// Is reports whether target is the kind of the error.
+func (err *Error) Is(target error) bool {
+	return target == err.Kind
+}
+
+// Unwrap returns the cause of the error.
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// New returns an error of kind with message.
+func New(kind error, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// Wrap returns an error of kind caused by err, with a message formatted from format and args.
+func Wrap(kind error, err error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...), Err: err}
+}
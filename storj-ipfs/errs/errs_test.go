@@ -0,0 +1,59 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var kinds = []error{ErrDaemonUnavailable, ErrInvalidHash, ErrAccessDenied, ErrDecrypt, ErrChunkMissing, ErrConfigInvalid}
+
+func TestErrorKinds(t *testing.T) {
+	cause := errors.New("connection refused")
+	for _, kind := range kinds {
+		for name, test := range map[string]struct {
+			err     error
+			message string
+			cause   error
+		}{
+			"new":         {err: New(kind, "message"), message: "message"},
+			"wrap":        {err: Wrap(kind, cause, "message %d", 1), message: "message 1", cause: cause},
+			"wrapped":     {err: fmt.Errorf("context: %w", Wrap(kind, cause, "message")), message: "message", cause: cause},
+			"wrapped new": {err: fmt.Errorf("context: %w", New(kind, "message")), message: "message"},
+			"wrap wrap":   {err: Wrap(kind, fmt.Errorf("context: %w", cause), "message"), message: "message", cause: cause},
+		} {
+			for _, other := range kinds {
+				if is := errors.Is(test.err, other); is != (other == kind) {
+					t.Errorf("%v %s: is %v %t", kind, name, other, is)
+				}
+			}
+			if test.cause != nil && !errors.Is(test.err, test.cause) {
+				t.Errorf("%v %s: is not its cause", kind, name)
+			}
+
+			var kindErr *Error
+			if !errors.As(test.err, &kindErr) {
+				t.Errorf("%v %s: not an *Error", kind, name)
+				continue
+			}
+			if kindErr.Kind != kind || kindErr.Message != test.message {
+				t.Errorf("%v %s: kind %v and message %q, expected %q", kind, name, kindErr.Kind, kindErr.Message, test.message)
+			}
+		}
+	}
+
+	// The kind of the cause is kept under the kind of its wrapper.
+	err := Wrap(ErrChunkMissing, New(ErrAccessDenied, "refused"), "manifest")
+	if !errors.Is(err, ErrChunkMissing) || !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("%v: lost a kind", err)
+	}
+	if message := err.Error(); message != "manifest: refused" {
+		t.Errorf("message %q", message)
+	}
+	if errors.Is(errors.New("invalid hash"), ErrInvalidHash) {
+		t.Error("an error with the message of a kind is of the kind")
+	}
+}
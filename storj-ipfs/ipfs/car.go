@@ -0,0 +1,262 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package ipfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// carV2Pragma starts every CARv2 archive: a CARv1 style header announcing version 2.
+var carV2Pragma = []byte{0x0a, 0xa1, 0x67, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x02}
+
+// carV2HeaderSize is the size of the CARv2 header following the pragma:
+// characteristics | data offset | data size | index offset.
+const carV2HeaderSize = 40
+
+// maxCARHeaderSize bounds the size of a CARv1 header read from an archive.
+const maxCARHeaderSize = 1024 * 1024
+
+// errInvalidCAR is returned for data that is not a CARv1 or CARv2 archive.
+var errInvalidCAR = errors.New("invalid CAR archive")
+
+// ReadCARRoots reads the header of a CARv1 or CARv2 archive from r
+// and returns the CAR version and the CIDs of the archive's roots.
+func ReadCARRoots(r io.Reader) (int, []string, error) {
+	reader := bufio.NewReader(r)
+	pragma, err := reader.Peek(len(carV2Pragma))
+	if err == nil && bytes.Equal(pragma, carV2Pragma) {
+		// Skip the pragma and the CARv2 header up to the CARv1 data it wraps.
+		var header [carV2HeaderSize]byte
+		if _, err := reader.Discard(len(carV2Pragma)); err != nil {
+			return 0, nil, err
+		}
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			return 0, nil, errInvalidCAR
+		}
+		dataOffset := binary.LittleEndian.Uint64(header[16:])
+		skip := int64(dataOffset) - int64(len(carV2Pragma)+carV2HeaderSize)
+		if skip < 0 {
+			return 0, nil, errInvalidCAR
+		}
+		if _, err := io.CopyN(ioutil.Discard, reader, skip); err != nil {
+			return 0, nil, errInvalidCAR
+		}
+		_, roots, err := readCARv1Header(reader)
+		return 2, roots, err
+	}
+	return readCARv1Header(reader)
+}
+
+// readCARv1Header reads the length prefixed DAG-CBOR header of a CARv1 archive:
+// a map with "version" and "roots", the roots being CIDs (CBOR tag 42).
+func readCARv1Header(reader *bufio.Reader) (int, []string, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil || length == 0 || length > maxCARHeaderSize {
+		return 0, nil, errInvalidCAR
+	}
+	header := make([]byte, length)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, nil, errInvalidCAR
+	}
+
+	decoder := &cborDecoder{data: header}
+	fields, err := decoder.mapLength()
+	if err != nil {
+		return 0, nil, err
+	}
+	version := 0
+	var roots []string
+	for i := 0; i < fields; i++ {
+		key, err := decoder.text()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch key {
+		case "version":
+			value, err := decoder.uint()
+			if err != nil {
+				return 0, nil, err
+			}
+			version = int(value)
+		case "roots":
+			count, err := decoder.arrayLength()
+			if err != nil {
+				return 0, nil, err
+			}
+			for j := 0; j < count; j++ {
+				root, err := decoder.link()
+				if err != nil {
+					return 0, nil, err
+				}
+				roots = append(roots, root)
+			}
+		default:
+			if err := decoder.skip(); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+	if version != 1 {
+		return 0, nil, fmt.Errorf("unsupported CAR version %d", version)
+	}
+	return version, roots, nil
+}
+
+// cborDecoder decodes the subset of DAG-CBOR used by CAR headers.
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// head reads the major type and argument of the next CBOR item.
+func (decoder *cborDecoder) head() (byte, uint64, error) {
+	if decoder.pos >= len(decoder.data) {
+		return 0, 0, errInvalidCAR
+	}
+	initial := decoder.data[decoder.pos]
+	decoder.pos++
+	major, info := initial>>5, initial&0x1f
+
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, errInvalidCAR
+	}
+	if decoder.pos+size > len(decoder.data) {
+		return 0, 0, errInvalidCAR
+	}
+	var value uint64
+	for _, b := range decoder.data[decoder.pos : decoder.pos+size] {
+		value = value<<8 | uint64(b)
+	}
+	decoder.pos += size
+	return major, value, nil
+}
+
+// expect reads the head of the next item and checks its major type.
+func (decoder *cborDecoder) expect(major byte) (uint64, error) {
+	actual, value, err := decoder.head()
+	if err != nil {
+		return 0, err
+	}
+	if actual != major {
+		return 0, errInvalidCAR
+	}
+	return value, nil
+}
+
+// uint reads an unsigned integer.
+func (decoder *cborDecoder) uint() (uint64, error) {
+	return decoder.expect(0)
+}
+
+// bytes reads a byte or text string of the given major type.
+func (decoder *cborDecoder) bytes(major byte) ([]byte, error) {
+	length, err := decoder.expect(major)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(len(decoder.data)-decoder.pos) {
+		return nil, errInvalidCAR
+	}
+	value := decoder.data[decoder.pos : decoder.pos+int(length)]
+	decoder.pos += int(length)
+	return value, nil
+}
+
+// text reads a text string.
+func (decoder *cborDecoder) text() (string, error) {
+	value, err := decoder.bytes(3)
+	return string(value), err
+}
+
+// arrayLength reads the head of an array.
+func (decoder *cborDecoder) arrayLength() (int, error) {
+	length, err := decoder.expect(4)
+	if length > uint64(len(decoder.data)) {
+		return 0, errInvalidCAR
+	}
+	return int(length), err
+}
+
+// mapLength reads the head of a map.
+func (decoder *cborDecoder) mapLength() (int, error) {
+	length, err := decoder.expect(5)
+	if length > uint64(len(decoder.data)) {
+		return 0, errInvalidCAR
+	}
+	return int(length), err
+}
+
+// link reads a CID: tag 42 wrapping the binary CID behind a zero byte.
+func (decoder *cborDecoder) link() (string, error) {
+	tag, err := decoder.expect(6)
+	if err != nil {
+		return "", err
+	}
+	if tag != 42 {
+		return "", errInvalidCAR
+	}
+	value, err := decoder.bytes(2)
+	if err != nil {
+		return "", err
+	}
+	if len(value) < 2 || value[0] != 0 {
+		return "", errInvalidCAR
+	}
+	link, err := cid.Cast(value[1:])
+	if err != nil {
+		return "", fmt.Errorf("invalid root in CAR archive: %v", err)
+	}
+	return link.String(), nil
+}
+
+// skip skips the next item, including everything nested in it.
+func (decoder *cborDecoder) skip() error {
+	major, value, err := decoder.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case 2, 3:
+		if value > uint64(len(decoder.data)-decoder.pos) {
+			return errInvalidCAR
+		}
+		decoder.pos += int(value)
+	case 4, 5:
+		items := value
+		if major == 5 {
+			items *= 2
+		}
+		if items > uint64(len(decoder.data)) {
+			return errInvalidCAR
+		}
+		for i := uint64(0); i < items; i++ {
+			if err := decoder.skip(); err != nil {
+				return err
+			}
+		}
+	case 6:
+		return decoder.skip()
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package ipfs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// CAR archives written by go-car/v2: a raw "hello" block as the only root, the same block
+// with a CIDv0 "world" block as two roots, and the first archive wrapped in a CARv2 with its index.
+const (
+	testCARv1      = "3aa265726f6f747381d82a582500015512202cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b98246776657273696f6e0129015512202cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b982468656c6c6f"
+	testCARv1Roots = "61a265726f6f747382d82a582500015512202cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824d82a5823001220486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a76776657273696f6e0129015512202cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b982468656c6c6f271220486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7776f726c64"
+	testCARv2      = "0aa16776657273696f6e02000000000000000000000000000000003300000000000000650000000000000098000000000000003aa265726f6f747381d82a582500015512202cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b98246776657273696f6e0129015512202cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b982468656c6c6f8108010000001200000000000000010000002800000028000000000000002cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b98243b00000000000000"
+
+	testHelloCID = "bafkreibm6jg3ux5qumhcn2b3flc3tyu6dmlb4xa7u5bf44yegnrjhc4yeq"
+	testWorldCID = "QmTDPv6TFivv9nGX3oiReXBiRcwtvDxkpARZUZC9Fwysre"
+)
+
+// testCAR decodes an archive from its hex encoding.
+func testCAR(t *testing.T, encoded string) []byte {
+	archive, err := hex.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func TestReadCARRoots(t *testing.T) {
+	for name, test := range map[string]struct {
+		archive string
+		version int
+		roots   []string
+	}{
+		"CARv1":              {testCARv1, 1, []string{testHelloCID}},
+		"CARv1 with 2 roots": {testCARv1Roots, 1, []string{testHelloCID, testWorldCID}},
+		"CARv2":              {testCARv2, 2, []string{testHelloCID}},
+	} {
+		version, roots, err := ReadCARRoots(bytes.NewReader(testCAR(t, test.archive)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if version != test.version || !reflect.DeepEqual(roots, test.roots) {
+			t.Errorf("%s: version %d with roots %v, expected version %d with roots %v", name, version, roots, test.version, test.roots)
+		}
+	}
+}
+
+func TestReadCARRootsTruncated(t *testing.T) {
+	v1 := testCAR(t, testCARv1)
+	v2 := testCAR(t, testCARv2)
+	// The CARv1 header is the 0x3a bytes after its length; the CARv2 header ends at 51, where the CARv1 data starts.
+	for name, archive := range map[string][]byte{
+		"empty":                    nil,
+		"CARv1 length only":        v1[:1],
+		"CARv1 inside the roots":   v1[:20],
+		"CARv1 before the version": v1[:0x3a],
+		"CARv2 pragma only":        v2[:len(carV2Pragma)],
+		"CARv2 inside the header":  v2[:30],
+		"CARv2 without data":       v2[:51],
+		"CARv2 inside the data":    v2[:70],
+		"not an archive":           []byte("hello world"),
+	} {
+		if _, roots, err := ReadCARRoots(bytes.NewReader(archive)); err == nil {
+			t.Errorf("%s: read roots %v", name, roots)
+		}
+	}
+}
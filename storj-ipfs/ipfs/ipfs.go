@@ -5,18 +5,21 @@ package ipfs
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strconv"
 
+	errs "storj-ipfs/errs"
+	logging "storj-ipfs/logging"
+	timeouts "storj-ipfs/timeouts"
+
+	cid "github.com/ipfs/go-cid"
 	shell "github.com/ipfs/go-ipfs-api"
 )
 
-// DEBUG allows more detailed working to be exposed through the terminal.
-var DEBUG = false
 var i int = 0
 
 // ConfigIPFS defines the variables and types.
@@ -25,8 +28,22 @@ type ConfigIPFS struct {
 	Port      string `json:"port"`
 	Path      string `json:"path"`
 	ChunkSize string `json:"chunkSize"`
+	// Chunker is a go-ipfs-chunker setting ("size-N", "rabin-min-avg-max" or "buzhash")
+	// used instead of ChunkSize.
+	Chunker string `json:"chunker"`
+	// DAG is the CID of a DAG on the node to store as a CAR archive instead of Path.
+	DAG string `json:"dag"`
+	// Format is "car" when Path is a CARv1 or CARv2 archive to store as a DAG.
+	Format string `json:"format"`
+	// CIDVersion is "0" (default) or "1" for the CIDs computed for the stored data.
+	CIDVersion string `json:"cidVersion"`
+	// Timeout bounds each request to the daemon, as a duration such as "30s"; empty means no limit.
+	Timeout string `json:"timeout"`
 }
 
+// FormatCAR is the Format of a CAR archive.
+const FormatCAR = "car"
+
 // Reader implements an io.Reader interface
 type Reader struct {
 	Sh         *shell.Shell
@@ -35,133 +52,254 @@ type Reader struct {
 
 // IPFSdata structure for ipfs data
 type IPFSdata struct {
-	Sh         *shell.Shell
+	Node       ContentNode
 	FilePath   string
 	ChunkSize  int64
+	Chunker    string
 	FileHandle *os.File
+	DAG        string
+	Format     string
+	CIDVersion int
+}
+
+// IsArchive reports whether the data to store is a DAG stored as a CAR archive.
+func (ipfsData *IPFSdata) IsArchive() bool {
+	return ipfsData.DAG != "" || ipfsData.Format == FormatCAR
+}
+
+// OverrideChunkSize replaces the chunking of the configuration with fixed chunks of chunkSize,
+// unless chunkSize is zero.
+func (configIPFS *ConfigIPFS) OverrideChunkSize(chunkSize int64) {
+	if chunkSize == 0 {
+		return
+	}
+	configIPFS.ChunkSize = strconv.FormatInt(chunkSize, 10)
+	configIPFS.Chunker = ""
 }
 
 // LoadIPFSProperty reads and parses the JSON file.
 // that contain a IPFS instance's property.
-// and returns all the properties as an object.
-func LoadIPFSProperty(fullFileName string) (ConfigIPFS, error) { // fullFileName for fetching IPFS credentials from  given JSON filename.
+// and returns all the properties as an object, logging them to logger.
+func LoadIPFSProperty(fullFileName string, logger *logging.Logger) (ConfigIPFS, error) { // fullFileName for fetching IPFS credentials from  given JSON filename.
 	var configIPFS ConfigIPFS
 
 	// Open and read the file
 	fileHandle, err := os.Open(fullFileName)
 	if err != nil {
-		return configIPFS, err
+		return configIPFS, errs.Wrap(errs.ErrConfigInvalid, err, "Could not read IPFS configuration")
 	}
 	defer fileHandle.Close()
 
 	jsonParser := json.NewDecoder(fileHandle)
-	jsonParser.Decode(&configIPFS)
+	if err := jsonParser.Decode(&configIPFS); err != nil {
+		return configIPFS, errs.Wrap(errs.ErrConfigInvalid, err, "Invalid IPFS configuration %q", fullFileName)
+	}
 
-	// Display read information.
-	fmt.Println("\nReading IPFS configuration from file: ", fullFileName)
-	fmt.Println("Host Name\t: ", configIPFS.HostName)
-	fmt.Println("Port\t\t: ", configIPFS.Port)
-	fmt.Println("Upload File Path: ", configIPFS.Path)
+	// Log read information.
+	logger.Info("Read IPFS configuration",
+		logging.Any("file", fullFileName),
+		logging.Any("hostName", configIPFS.HostName),
+		logging.Any("port", configIPFS.Port),
+		logging.Any("chunkSize", configIPFS.ChunkSize),
+		logging.Any("chunker", configIPFS.Chunker),
+		logging.Any("cidVersion", configIPFS.CIDVersion),
+		logging.Any("timeout", configIPFS.Timeout),
+		logging.Any("dag", configIPFS.DAG),
+		logging.Any("path", configIPFS.Path))
 
 	return configIPFS, nil
 }
 
-// ConnectToIPFSStorj will connect to a IPFS instance,
+// loadIPFSConfig reads the IPFS configuration from fullFileName, with its chunking
+// overridden by a positive chunkSize, logging to the logger of ctx.
+func loadIPFSConfig(ctx context.Context, fullFileName string, chunkSize int64) (ConfigIPFS, error) {
+	logger := logging.FromContext(ctx)
+	configIPFS, err := LoadIPFSProperty(fullFileName, logger)
+	if err != nil {
+		return configIPFS, err
+	}
+	if chunkSize != 0 {
+		logger.Info("Overriding chunking", logging.Any("chunkSize", chunkSize))
+		configIPFS.OverrideChunkSize(chunkSize)
+	}
+	return configIPFS, nil
+}
+
+// ConnectToIPFSStorj will prepare a IPFS instance,
 // based on the read property from an external file.
+// The daemon is only contacted when a DAG has to be exported from it.
+// A positive chunkSize overrides the chunk size and chunker of the file.
 // It returns a reference to an io.Reader with IPFS instance information.
-func ConnectToIPFSStorj(fullFileName string) (*IPFSdata, error) { // fullFileName for fetching  from given JSON filename.
+func ConnectToIPFSStorj(ctx context.Context, fullFileName string, chunkSize int64) (*IPFSdata, error) { // fullFileName for fetching  from given JSON filename.
 
 	// Read IPFS instance's properties from an external file.
-	configIPFS, err := LoadIPFSProperty(fullFileName)
+	configIPFS, err := loadIPFSConfig(ctx, fullFileName, chunkSize)
+	if err != nil {
+		return nil, err
+	}
 
+	// Connect IPFS deamon to IPFS node.
+	node, err := configuredNode(configIPFS)
 	if err != nil {
-		fmt.Printf("LoadIPFSProperty: %s\n", err)
 		return nil, err
 	}
-	fmt.Println("\nConnecting to IPFS...")
+	return OpenIPFSData(ctx, node, configIPFS)
+}
 
-	if configIPFS.HostName == "ipfsHostName" || configIPFS.HostName == "" {
-		err1 := errors.New("Invalid HostName")
-		return nil, err1
+// ConnectToIPFSNode will connect to a IPFS instance,
+// based on the read property from an external file, without opening a file to upload.
+// A positive chunkSize overrides the chunk size and chunker of the file.
+// It returns a reference to the IPFS node and the chunk size.
+func ConnectToIPFSNode(ctx context.Context, fullFileName string, chunkSize int64) (*IPFSdata, error) { // fullFileName for fetching  from given JSON filename.
+
+	// Read IPFS instance's properties from an external file.
+	configIPFS, err := loadIPFSConfig(ctx, fullFileName, chunkSize)
+	if err != nil {
+		return nil, err
 	}
+
 	// Connect IPFS deamon to IPFS node.
-	sh := shell.NewShell(configIPFS.HostName + ":" + configIPFS.Port)
-	_, _, errVer := sh.Version()
-	if errVer != nil {
-		err1 := errors.New("Could not find Daemon running")
+	node, err := configuredNode(configIPFS)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckNode(ctx, node); err != nil {
+		return nil, err
+	}
+	return OpenIPFSNode(node, configIPFS)
+}
+
+// configuredNode returns the node of the daemon at the host name and port of configIPFS,
+// with its requests bounded by the configured timeout.
+func configuredNode(configIPFS ConfigIPFS) (ContentNode, error) {
+	if configIPFS.HostName == "ipfsHostName" || configIPFS.HostName == "" {
+		err1 := errs.New(errs.ErrConfigInvalid, "Invalid HostName")
 		return nil, err1
 	}
+	timeout, err := timeouts.Parse(configIPFS.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return NodeWithTimeout(NewHTTPNode(configIPFS.HostName+":"+configIPFS.Port), timeout), nil
+}
+
+// OpenIPFSData validates the chunk size and opens the file to upload,
+// checking that node can be reached only when a DAG is exported from it.
+// It returns a reference to the IPFS node and the opened file.
+func OpenIPFSData(ctx context.Context, node ContentNode, configIPFS ConfigIPFS) (*IPFSdata, error) {
+	ipfsData, err := OpenIPFSNode(node, configIPFS)
+	if err != nil {
+		return nil, err
+	}
+	if configIPFS.Format != "" && configIPFS.Format != FormatCAR {
+		return nil, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("Invalid format %q", configIPFS.Format))
+	}
+	ipfsData.Format = configIPFS.Format
+
+	// A DAG is exported from the node, so there is no file to open.
+	if configIPFS.DAG != "" {
+		if err := ValidateHash(configIPFS.DAG); err != nil {
+			return nil, errs.New(errs.ErrConfigInvalid, "Invalid DAG CID entered")
+		}
+		if err := CheckNode(ctx, node); err != nil {
+			return nil, err
+		}
+		ipfsData.DAG = configIPFS.DAG
+		return ipfsData, nil
+	}
 
 	file, err1 := os.Open(configIPFS.Path)
 	if err1 != nil {
-		err2 := errors.New("Invalid File path entered")
+		err2 := errs.Wrap(errs.ErrConfigInvalid, err1, "Invalid File path entered")
 		return nil, err2
 	}
 
+	// Return IPFS connection object, chunk size and file path.
+	ipfsData.FilePath = configIPFS.Path
+	ipfsData.FileHandle = file
+	return ipfsData, nil
+}
+
+// OpenIPFSNode validates the chunk size and the CID version without contacting node.
+// Without a chunker setting, files are split into chunks of the chunk size ("size-N").
+// It returns a reference to the IPFS node without a file.
+func OpenIPFSNode(node ContentNode, configIPFS ConfigIPFS) (*IPFSdata, error) {
 	// Convert size of chunks into int64
 	givenSize, _ := strconv.ParseInt(configIPFS.ChunkSize, 10, 64)
 
-	if givenSize <= 0 {
-		err1 := errors.New("Invalid chunk size entered")
-		return nil, err1
+	chunker := configIPFS.Chunker
+	if chunker == "" {
+		if givenSize <= 0 {
+			err1 := errs.New(errs.ErrConfigInvalid, "Invalid chunk size entered")
+			return nil, err1
+		}
+		chunker = "size-" + strconv.FormatInt(givenSize, 10)
 	}
 
-	// Inform about successful connection.
-	fmt.Println("Successfully connected to IPFS!")
+	cidVersion, err := ParseCIDVersion(configIPFS.CIDVersion)
+	if err != nil {
+		return nil, err
+	}
 
-	// Return IPFS connection object, chunk size and file path.
-	return &IPFSdata{Sh: sh, ChunkSize: givenSize, FilePath: configIPFS.Path, FileHandle: file}, nil
+	return &IPFSdata{Node: node, ChunkSize: givenSize, Chunker: chunker, CIDVersion: cidVersion}, nil
 }
 
-// CreateCID will connect to a IPFS instance,
-// based on the read property from an external file.
-// It returns Created CID.
-func CreateCID(ipfsData *IPFSdata, data []byte) (string, error) { // fullFileName for fetching  from given JSON filename.
-
-	readers := bytes.NewReader(data)
-
-	// Create encrypt chunk CID
-	encryptChunkCID, err := ipfsData.Sh.Add(readers, shell.OnlyHash(true))
+// CheckNode checks that the daemon behind node can be reached.
+func CheckNode(ctx context.Context, node ContentNode) error {
+	logger := logging.FromContext(ctx)
+	logger.Debug("Connecting to IPFS")
+	version, errVer := node.Version(ctx)
+	if errVer != nil {
+		err1 := errs.Wrap(errs.ErrDaemonUnavailable, errVer, "Could not find Daemon running")
+		return err1
+	}
 
-	// Return IPFS connection object, chunk size and file path.
-	return encryptChunkCID, err
+	// Inform about successful connection.
+	logger.Info("Connected to IPFS", logging.Any("version", version))
+	return nil
 }
 
-// ConnectToIPFSForDownload will connect to a IPFS instance,
-// based on the hash name of file on IPFS.
-// It returns a reference to an io.Reader with IPFS instance information
-func ConnectToIPFSForDownload(hash string, hostName string, port string) (*bytes.Reader, error) { // fullFileName for fetching  from given JSON filename.
-
-	fmt.Println("\nConnecting to IPFS...")
-	if hostName == "ipfsHostName" || hostName == "" {
-		err1 := errors.New("Invalid HostName")
-		return nil, err1
-	}
-
-	if hash[0:2] != "Qm" || len(hash) != 46 {
-		err1 := errors.New("Invalid Shareable Hash")
-		return nil, err1
+// ValidateHash checks that hash is a CID, accepting both
+// CIDv0 (Qm...) and CIDv1 (bafy...) shareable hashes.
+func ValidateHash(hash string) error {
+	if _, err := cid.Decode(hash); err != nil {
+		return errs.New(errs.ErrInvalidHash, "Invalid Shareable Hash")
 	}
+	return nil
+}
 
-	// Connect to IPFS daemon to IPFS node.
-	sh := shell.NewShell(hostName + ":" + port)
-	_, _, errVer := sh.Version()
-	if errVer != nil {
-		err1 := errors.New("Could not find Daemon running")
-		return nil, err1
+// ReadFromNode reads the content stored under hash from node.
+// It returns a reference to an io.Reader with the content.
+func ReadFromNode(ctx context.Context, node ContentNode, hash string) (*bytes.Reader, error) {
+	if err := CheckNode(ctx, node); err != nil {
+		return nil, err
 	}
 
-	// Inform about successful connection.
-	fmt.Println("\nSuccessfully connected to IPFS!")
-
 	// Get data from ipfs node.
-	fileReader, err := sh.Cat(hash)
+	fileReader, err := node.Cat(ctx, hash)
 	if err != nil {
-		fmt.Println("IPFS data read error: ", err)
+		return nil, fmt.Errorf("IPFS data read error: %w", err)
 	}
+	defer fileReader.Close()
 
 	// Read all data recive from ipfs.
-	readbytes, _ := ioutil.ReadAll(fileReader)
+	readbytes, err := ioutil.ReadAll(fileReader)
 	reader := bytes.NewReader(readbytes)
 	return reader, err
 }
+
+// PublishToNode adds data to node as a CIDv0 and pins it.
+// It returns the shareable hash of the published data.
+func PublishToNode(ctx context.Context, node ContentNode, data []byte) (string, error) {
+	if err := CheckNode(ctx, node); err != nil {
+		return "", err
+	}
+	hash, err := node.Add(ctx, bytes.NewReader(data), 0)
+	if err != nil {
+		return "", err
+	}
+	if err := node.Pin(ctx, hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
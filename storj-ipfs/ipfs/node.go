@@ -0,0 +1,373 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	timeouts "storj-ipfs/timeouts"
+
+	shell "github.com/ipfs/go-ipfs-api"
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+// ContentNode is the set of IPFS operations the connector needs from a node.
+// Every operation stops when its context is done.
+type ContentNode interface {
+	// Add stores data on the node with the default chunker and layout, without pinning it,
+	// and returns its CID of cidVersion, the one ComputeCID returns.
+	Add(ctx context.Context, data io.Reader, cidVersion int) (string, error)
+	// Cat returns a reader over the content stored under path.
+	Cat(ctx context.Context, path string) (io.ReadCloser, error)
+	// Version returns the version of the node, failing if it cannot be reached.
+	Version(ctx context.Context) (string, error)
+	// Pin pins path on the node so it is kept by garbage collection.
+	Pin(ctx context.Context, path string) error
+	// Pins returns the pin type ("recursive" or "direct") of every CID pinned on the node.
+	// Indirect pins are left out, as they are kept by the recursive pins above them.
+	Pins(ctx context.Context) (map[string]string, error)
+	// DagExport returns a CAR archive of the DAG rooted at path.
+	DagExport(ctx context.Context, path string) (io.ReadCloser, error)
+	// DagImport stores the blocks of a CAR archive without pinning them
+	// and returns the CIDs of its roots.
+	DagImport(ctx context.Context, car io.Reader) ([]string, error)
+	// PinDirect pins only the block at path, not the blocks below it.
+	PinDirect(ctx context.Context, path string) error
+	// RemoveBlock removes the block at path unless it is pinned,
+	// leaving the unpinned blocks below it to garbage collection.
+	RemoveBlock(ctx context.Context, path string) error
+}
+
+// httpNode is a ContentNode that talks to a daemon through its HTTP API.
+type httpNode struct {
+	sh *shell.Shell
+}
+
+// NewHTTPNode returns a ContentNode using the HTTP API of the daemon listening on address (host:port).
+func NewHTTPNode(address string) ContentNode {
+	return &httpNode{sh: shell.NewShell(address)}
+}
+
+// Add stores data on the daemon, which uses raw leaves for CIDv1. The daemon pins added
+// data by default, so the pin option is turned off.
+func (node *httpNode) Add(ctx context.Context, data io.Reader, cidVersion int) (string, error) {
+	directory := files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", files.NewReaderFile(data))})
+	var result struct {
+		Hash string
+	}
+	err := node.sh.Request("add").
+		Option("cid-version", cidVersion).
+		Option("pin", false).
+		Body(files.NewMultiFileReader(directory, true)).
+		Exec(ctx, &result)
+	return result.Hash, err
+}
+
+// Cat reads the content stored under path from the daemon.
+func (node *httpNode) Cat(ctx context.Context, path string) (io.ReadCloser, error) {
+	return node.stream(ctx, node.sh.Request("cat", path))
+}
+
+// Version returns the version reported by the daemon.
+func (node *httpNode) Version(ctx context.Context) (string, error) {
+	var result struct {
+		Version string
+	}
+	err := node.sh.Request("version").Exec(ctx, &result)
+	return result.Version, err
+}
+
+// Pin pins path on the daemon.
+func (node *httpNode) Pin(ctx context.Context, path string) error {
+	return node.sh.Request("pin/add", path).Option("recursive", true).Exec(ctx, nil)
+}
+
+// Pins lists the recursive and direct pins of the daemon.
+func (node *httpNode) Pins(ctx context.Context) (map[string]string, error) {
+	var result struct {
+		Keys map[string]shell.PinInfo
+	}
+	if err := node.sh.Request("pin/ls").Exec(ctx, &result); err != nil {
+		return nil, err
+	}
+	pins := make(map[string]string, len(result.Keys))
+	for hash, info := range result.Keys {
+		if info.Type == shell.RecursivePin || info.Type == shell.DirectPin {
+			pins[hash] = info.Type
+		}
+	}
+	return pins, nil
+}
+
+// DagExport streams a CAR archive of the DAG rooted at path from the daemon.
+func (node *httpNode) DagExport(ctx context.Context, path string) (io.ReadCloser, error) {
+	return node.stream(ctx, node.sh.Request("dag/export", path))
+}
+
+// stream sends request and returns the output of the daemon.
+func (node *httpNode) stream(ctx context.Context, request *shell.RequestBuilder) (io.ReadCloser, error) {
+	response, err := request.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		response.Close()
+		return nil, response.Error
+	}
+	return response.Output, nil
+}
+
+// DagImport sends a CAR archive to the daemon and reads the roots it reports.
+func (node *httpNode) DagImport(ctx context.Context, car io.Reader) ([]string, error) {
+	directory := files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", files.NewReaderFile(car))})
+	response, err := node.sh.Request("dag/import").
+		Option("pin-roots", false).
+		Body(files.NewMultiFileReader(directory, true)).
+		Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Close()
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	// The daemon reports one JSON object per root.
+	var roots []string
+	decoder := json.NewDecoder(response.Output)
+	for {
+		var result struct {
+			Root struct {
+				Cid struct {
+					Link string `json:"/"`
+				}
+				PinErrorMsg string
+			}
+		}
+		if err := decoder.Decode(&result); err == io.EOF {
+			return roots, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid dag import response: %v", err)
+		}
+		if result.Root.Cid.Link != "" {
+			roots = append(roots, result.Root.Cid.Link)
+		}
+	}
+}
+
+// PinDirect pins only the block at path on the daemon.
+func (node *httpNode) PinDirect(ctx context.Context, path string) error {
+	return node.sh.Request("pin/add", path).Option("recursive", false).Exec(ctx, nil)
+}
+
+// RemoveBlock removes the block at path from the daemon, which refuses to remove pinned blocks.
+func (node *httpNode) RemoveBlock(ctx context.Context, path string) error {
+	return node.sh.Request("block/rm", path).Exec(ctx, nil)
+}
+
+// timeoutNode bounds every operation of a ContentNode by a timeout.
+type timeoutNode struct {
+	node    ContentNode
+	timeout time.Duration
+}
+
+// NodeWithTimeout returns node with every operation, including reading the content it returns,
+// bounded by timeout. A timeout of zero returns node unchanged.
+func NodeWithTimeout(node ContentNode, timeout time.Duration) ContentNode {
+	if timeout <= 0 {
+		return node
+	}
+	return &timeoutNode{node: node, timeout: timeout}
+}
+
+// Add adds data to the node within the timeout.
+func (node *timeoutNode) Add(ctx context.Context, data io.Reader, cidVersion int) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, node.timeout)
+	defer cancel()
+	return node.node.Add(ctx, data, cidVersion)
+}
+
+// Cat returns the content under path, which must be read within the timeout.
+func (node *timeoutNode) Cat(ctx context.Context, path string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(ctx, node.timeout)
+	reader, err := node.node.Cat(ctx, path)
+	return timeouts.CancelOnClose(reader, err, cancel)
+}
+
+// Version returns the version of the node within the timeout.
+func (node *timeoutNode) Version(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, node.timeout)
+	defer cancel()
+	return node.node.Version(ctx)
+}
+
+// Pin pins path within the timeout.
+func (node *timeoutNode) Pin(ctx context.Context, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, node.timeout)
+	defer cancel()
+	return node.node.Pin(ctx, path)
+}
+
+// Pins lists the pins of the node within the timeout.
+func (node *timeoutNode) Pins(ctx context.Context) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, node.timeout)
+	defer cancel()
+	return node.node.Pins(ctx)
+}
+
+// DagExport returns the archive of path, which must be read within the timeout.
+func (node *timeoutNode) DagExport(ctx context.Context, path string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(ctx, node.timeout)
+	reader, err := node.node.DagExport(ctx, path)
+	return timeouts.CancelOnClose(reader, err, cancel)
+}
+
+// DagImport imports car within the timeout.
+func (node *timeoutNode) DagImport(ctx context.Context, car io.Reader) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, node.timeout)
+	defer cancel()
+	return node.node.DagImport(ctx, car)
+}
+
+// PinDirect pins the block at path within the timeout.
+func (node *timeoutNode) PinDirect(ctx context.Context, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, node.timeout)
+	defer cancel()
+	return node.node.PinDirect(ctx, path)
+}
+
+// RemoveBlock removes the block at path within the timeout.
+func (node *timeoutNode) RemoveBlock(ctx context.Context, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, node.timeout)
+	defer cancel()
+	return node.node.RemoveBlock(ctx, path)
+}
+
+// FakeNode is an in-process ContentNode that keeps added content in memory.
+// CIDs are computed with ComputeCID, so they are the daemon's CIDs.
+// It has no DAGs, so exports are the raw content.
+type FakeNode struct {
+	mu       sync.Mutex
+	contents map[string][]byte
+	pins     map[string]string
+}
+
+// NewFakeNode returns an empty in-memory ContentNode.
+func NewFakeNode() *FakeNode {
+	return &FakeNode{contents: make(map[string][]byte), pins: make(map[string]string)}
+}
+
+// Add stores data in memory and returns its CID.
+func (node *FakeNode) Add(ctx context.Context, data io.Reader, cidVersion int) (string, error) {
+	contents, err := ioutil.ReadAll(data)
+	if err != nil {
+		return "", err
+	}
+	hash, err := ComputeCID(bytes.NewReader(contents), cidVersion)
+	if err != nil {
+		return "", err
+	}
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	node.contents[hash] = contents
+	return hash, nil
+}
+
+// Cat returns the content previously added under path.
+func (node *FakeNode) Cat(ctx context.Context, path string) (io.ReadCloser, error) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	contents, ok := node.contents[path]
+	if !ok {
+		return nil, fmt.Errorf("%s: not found", path)
+	}
+	return ioutil.NopCloser(bytes.NewReader(contents)), nil
+}
+
+// Version always succeeds for the in-process node.
+func (node *FakeNode) Version(ctx context.Context) (string, error) {
+	return "fake", nil
+}
+
+// Pin marks previously added content as pinned.
+func (node *FakeNode) Pin(ctx context.Context, path string) error {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	if _, ok := node.contents[path]; !ok {
+		return errors.New(path + ": not found")
+	}
+	node.pins[path] = shell.RecursivePin
+	return nil
+}
+
+// Pinned reports whether path has been pinned.
+func (node *FakeNode) Pinned(path string) bool {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	return node.pins[path] != ""
+}
+
+// Pins returns the pin type of every pinned CID.
+func (node *FakeNode) Pins(ctx context.Context) (map[string]string, error) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	pins := make(map[string]string, len(node.pins))
+	for hash, pinType := range node.pins {
+		pins[hash] = pinType
+	}
+	return pins, nil
+}
+
+// DagExport returns the content previously added under path.
+func (node *FakeNode) DagExport(ctx context.Context, path string) (io.ReadCloser, error) {
+	return node.Cat(ctx, path)
+}
+
+// DagImport adds the archive as raw content and returns its CID as the only root.
+func (node *FakeNode) DagImport(ctx context.Context, car io.Reader) ([]string, error) {
+	hash, err := node.Add(ctx, car, 0)
+	if err != nil {
+		return nil, err
+	}
+	return []string{hash}, nil
+}
+
+// PinDirect marks previously added content as directly pinned.
+func (node *FakeNode) PinDirect(ctx context.Context, path string) error {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	if _, ok := node.contents[path]; !ok {
+		return errors.New(path + ": not found")
+	}
+	node.pins[path] = shell.DirectPin
+	return nil
+}
+
+// RemoveBlock drops previously added content unless it is pinned.
+func (node *FakeNode) RemoveBlock(ctx context.Context, path string) error {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	if _, ok := node.contents[path]; !ok {
+		return errors.New(path + ": not found")
+	}
+	if node.pins[path] != "" {
+		return errors.New(path + ": pinned")
+	}
+	delete(node.contents, path)
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestPublishToNode(t *testing.T) {
+	ctx := context.Background()
+	node := NewFakeNode()
+	pointer := []byte("pointer blob")
+
+	hash, err := PublishToNode(ctx, node, pointer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ComputeCID(bytes.NewReader(pointer), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != expected {
+		t.Errorf("published as %s, expected %s", hash, expected)
+	}
+	if !node.Pinned(hash) {
+		t.Errorf("%s is not pinned", hash)
+	}
+
+	content, err := node.Cat(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	published, err := ioutil.ReadAll(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(published, pointer) {
+		t.Errorf("published %q, expected %q", published, pointer)
+	}
+}
+
+func TestReadFromNode(t *testing.T) {
+	ctx := context.Background()
+	node := NewFakeNode()
+	hash, err := node.Add(ctx, strings.NewReader("shared data"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := ReadFromNode(ctx, node, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "shared data" {
+		t.Errorf("read %q, expected %q", data, "shared data")
+	}
+
+	missing, err := ComputeCID(strings.NewReader("never added"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFromNode(ctx, node, missing); err == nil {
+		t.Errorf("read %s, which was never added", missing)
+	}
+}
+
+func TestRestoreFile(t *testing.T) {
+	ctx := context.Background()
+	for _, version := range []int{0, 1} {
+		node := NewFakeNode()
+		baseCID, err := ComputeCID(strings.NewReader("restored data"), version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := RestoreFile(ctx, node, strings.NewReader("restored data"), baseCID); err != nil {
+			t.Fatalf("CIDv%d: %v", version, err)
+		}
+		if !node.Pinned(baseCID) {
+			t.Errorf("CIDv%d: %s is not pinned", version, baseCID)
+		}
+
+		// Data that does not match the recorded CID is rejected and removed instead of pinned.
+		otherCID, err := ComputeCID(strings.NewReader("altered data"), version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = RestoreFile(ctx, node, strings.NewReader("altered data"), baseCID)
+		if err == nil || !strings.Contains(err.Error(), otherCID) {
+			t.Fatalf("CIDv%d: restoring data that does not match its CID: %v", version, err)
+		}
+		if node.Pinned(otherCID) {
+			t.Errorf("CIDv%d: mismatched data %s is pinned", version, otherCID)
+		}
+		if _, err := node.Cat(ctx, otherCID); err == nil {
+			t.Errorf("CIDv%d: mismatched data %s is left on the node", version, otherCID)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package ipfs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	shell "github.com/ipfs/go-ipfs-api"
+)
+
+// RecursivePin and DirectPin are the pin types of pinned DAGs.
+const (
+	RecursivePin = shell.RecursivePin
+	DirectPin    = shell.DirectPin
+)
+
+// PinnedDAG is the root of a DAG pinned on a node, with its pin type.
+type PinnedDAG struct {
+	CID  string
+	Type string
+}
+
+// ListPins returns the recursive and direct pins of node, sorted by CID.
+func ListPins(ctx context.Context, node ContentNode) ([]PinnedDAG, error) {
+	pins, err := node.Pins(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not list pins: %v", err)
+	}
+
+	pinset := make([]PinnedDAG, 0, len(pins))
+	for hash, pinType := range pins {
+		pinset = append(pinset, PinnedDAG{CID: hash, Type: pinType})
+	}
+	sort.Slice(pinset, func(i, j int) bool { return pinset[i].CID < pinset[j].CID })
+	return pinset, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package ipfs
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestListPins(t *testing.T) {
+	ctx := context.Background()
+	node := NewFakeNode()
+	var expected []PinnedDAG
+	for _, content := range []string{"recursive one", "recursive two", "direct", "not pinned"} {
+		hash, err := node.Add(ctx, strings.NewReader(content), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case strings.HasPrefix(content, "recursive"):
+			err = node.Pin(ctx, hash)
+			expected = append(expected, PinnedDAG{CID: hash, Type: RecursivePin})
+		case content == "direct":
+			err = node.PinDirect(ctx, hash)
+			expected = append(expected, PinnedDAG{CID: hash, Type: DirectPin})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Slice(expected, func(i, j int) bool { return expected[i].CID < expected[j].CID })
+
+	pins, err := ListPins(ctx, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pins, expected) {
+		t.Errorf("listed %v, expected %v", pins, expected)
+	}
+
+	if pins, err := ListPins(ctx, NewFakeNode()); err != nil || len(pins) != 0 {
+		t.Errorf("listed %v on an empty node: %v", pins, err)
+	}
+}
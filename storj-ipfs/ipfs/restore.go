@@ -0,0 +1,75 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package ipfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// RestoreFile adds the content read from data to node with the CID version of baseCID,
+// checks that it was stored under baseCID, the CID recorded when it was stored, and pins it.
+// Content stored under another CID is removed from the node instead of being pinned.
+func RestoreFile(ctx context.Context, node ContentNode, data io.Reader, baseCID string) error {
+	hash, err := node.Add(ctx, data, CIDVersion(baseCID))
+	if err != nil {
+		return fmt.Errorf("could not add restored data to IPFS: %v", err)
+	}
+	if !SameCID(hash, baseCID) {
+		if err := node.RemoveBlock(ctx, hash); err != nil {
+			return fmt.Errorf("restored data has CID %s, expected %s, and could not be removed: %v", hash, baseCID, err)
+		}
+		return fmt.Errorf("restored data has CID %s, expected %s", hash, baseCID)
+	}
+	if err := node.Pin(ctx, hash); err != nil {
+		return fmt.Errorf("could not pin %s: %v", hash, err)
+	}
+	return nil
+}
+
+// RestoreDAG imports the CAR archive read from car into node, checks that root
+// is one of its roots and pins root with pinType ("recursive" or "direct").
+func RestoreDAG(ctx context.Context, node ContentNode, car io.Reader, root string, pinType string) error {
+	roots, err := node.DagImport(ctx, car)
+	if err != nil {
+		return fmt.Errorf("could not import %s: %v", root, err)
+	}
+
+	found := false
+	for _, imported := range roots {
+		if SameCID(imported, root) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("archive of %s has roots %v", root, roots)
+	}
+
+	if pinType == DirectPin {
+		err = node.PinDirect(ctx, root)
+	} else {
+		err = node.Pin(ctx, root)
+	}
+	if err != nil {
+		return fmt.Errorf("could not pin %s: %v", root, err)
+	}
+	return nil
+}
+
+// SameCID reports whether a and b are the same CID, whatever their string encoding.
+func SameCID(a string, b string) bool {
+	first, err := cid.Decode(a)
+	if err != nil {
+		return false
+	}
+	second, err := cid.Decode(b)
+	if err != nil {
+		return false
+	}
+	return first.Equals(second)
+}
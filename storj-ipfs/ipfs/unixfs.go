@@ -0,0 +1,235 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package ipfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+
+	errs "storj-ipfs/errs"
+
+	cid "github.com/ipfs/go-cid"
+	multihash "github.com/multiformats/go-multihash"
+)
+
+// DefaultChunkSize is the size of the leaves the daemon splits added data into by default.
+const DefaultChunkSize = 256 * 1024
+
+// DefaultLinksPerBlock is the most links a node has in the daemon's balanced layout.
+const DefaultLinksPerBlock = 174
+
+// unixfsFile is the UnixFS type of the nodes of a file.
+const unixfsFile = 2
+
+// ParseCIDVersion converts a configured CID version, falling back to 0 when it is empty.
+func ParseCIDVersion(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || (version != 0 && version != 1) {
+		return 0, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("Invalid CID version %q", value))
+	}
+	return version, nil
+}
+
+// CIDVersion returns the version of the CID hash, or 0 if it is not a CID.
+func CIDVersion(hash string) int {
+	decoded, err := cid.Decode(hash)
+	if err != nil {
+		return 0
+	}
+	return int(decoded.Version())
+}
+
+// ComputeCID returns the CID the daemon adds data under with its default settings,
+// without contacting it: data is split into DefaultChunkSize leaves which are
+// linked in a balanced UnixFS DAG. Version 0 gives a CIDv0 with dag-pb leaves,
+// version 1 a CIDv1 with raw leaves, like "ipfs add --cid-version=1".
+func ComputeCID(data io.Reader, version int) (string, error) {
+	return computeCID(data, version, DefaultChunkSize)
+}
+
+// computeCID returns the CID of data split into leaves of chunkSize.
+func computeCID(data io.Reader, version int, chunkSize int) (string, error) {
+	if version != 0 && version != 1 {
+		return "", fmt.Errorf("unsupported CID version %d", version)
+	}
+
+	builder := &dagBuilder{rawLeaves: version == 1}
+	chunk := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(data, chunk)
+		if n > 0 {
+			leaf, err := builder.leaf(chunk[:n])
+			if err != nil {
+				return "", err
+			}
+			if err := builder.push(0, leaf); err != nil {
+				return "", err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	root, err := builder.finish()
+	if err != nil {
+		return "", err
+	}
+	return root.cid.String(), nil
+}
+
+// dagNode is a node of a file DAG as it is linked from its parent.
+type dagNode struct {
+	cid cid.Cid
+	// treeSize is the size of the node's block and of all blocks below it.
+	treeSize uint64
+	// fileSize is the size of the file data below the node.
+	fileSize uint64
+}
+
+// dagBuilder builds a balanced file DAG from its leaves in order,
+// keeping only the nodes that are not linked from a parent yet.
+type dagBuilder struct {
+	rawLeaves bool
+	// levels holds the unlinked nodes of every depth, leaves first.
+	levels [][]dagNode
+}
+
+// push adds node at depth level. A full level is first linked from a new parent
+// one level up, so every node but the last of a level has DefaultLinksPerBlock links.
+func (builder *dagBuilder) push(level int, node dagNode) error {
+	if level == len(builder.levels) {
+		builder.levels = append(builder.levels, nil)
+	}
+	if len(builder.levels[level]) == DefaultLinksPerBlock {
+		parent, err := builder.parent(builder.levels[level])
+		if err != nil {
+			return err
+		}
+		builder.levels[level] = nil
+		if err := builder.push(level+1, parent); err != nil {
+			return err
+		}
+	}
+	builder.levels[level] = append(builder.levels[level], node)
+	return nil
+}
+
+// finish links the remaining nodes of every level and returns the root.
+// A single leaf is its own root, and no data gives an empty leaf.
+func (builder *dagBuilder) finish() (dagNode, error) {
+	if len(builder.levels) == 0 {
+		return builder.leaf(nil)
+	}
+	for level := 0; ; level++ {
+		nodes := builder.levels[level]
+		if level == len(builder.levels)-1 && len(nodes) == 1 {
+			return nodes[0], nil
+		}
+		parent, err := builder.parent(nodes)
+		if err != nil {
+			return dagNode{}, err
+		}
+		builder.levels[level] = nil
+		if err := builder.push(level+1, parent); err != nil {
+			return dagNode{}, err
+		}
+	}
+}
+
+// leaf returns the leaf holding data: a raw block, or a dag-pb node with UnixFS file data.
+func (builder *dagBuilder) leaf(data []byte) (dagNode, error) {
+	if builder.rawLeaves {
+		hash, err := multihash.Sum(data, multihash.SHA2_256, -1)
+		if err != nil {
+			return dagNode{}, err
+		}
+		size := uint64(len(data))
+		return dagNode{cid: cid.NewCidV1(cid.Raw, hash), treeSize: size, fileSize: size}, nil
+	}
+
+	block := encodePBNode(nil, encodeUnixFSFile(data, uint64(len(data)), nil))
+	return builder.node(block, uint64(len(block)), uint64(len(data)))
+}
+
+// parent returns the dag-pb node linking children.
+func (builder *dagBuilder) parent(children []dagNode) (dagNode, error) {
+	var fileSize, treeSize uint64
+	blockSizes := make([]uint64, len(children))
+	for i, child := range children {
+		blockSizes[i] = child.fileSize
+		fileSize += child.fileSize
+		treeSize += child.treeSize
+	}
+
+	block := encodePBNode(children, encodeUnixFSFile(nil, fileSize, blockSizes))
+	return builder.node(block, treeSize+uint64(len(block)), fileSize)
+}
+
+// node returns the dag-pb node of block: a CIDv0, or a CIDv1 when leaves are raw.
+func (builder *dagBuilder) node(block []byte, treeSize uint64, fileSize uint64) (dagNode, error) {
+	hash, err := multihash.Sum(block, multihash.SHA2_256, -1)
+	if err != nil {
+		return dagNode{}, err
+	}
+	nodeCID := cid.NewCidV0(hash)
+	if builder.rawLeaves {
+		nodeCID = cid.NewCidV1(cid.DagProtobuf, hash)
+	}
+	return dagNode{cid: nodeCID, treeSize: treeSize, fileSize: fileSize}, nil
+}
+
+// encodeUnixFSFile encodes the UnixFS data of a file node:
+// Type (1), Data (2), filesize (3) and one blocksizes (4) entry per link.
+func encodeUnixFSFile(data []byte, fileSize uint64, blockSizes []uint64) []byte {
+	encoded := appendVarintField(nil, 1, unixfsFile)
+	if len(data) > 0 {
+		encoded = appendBytesField(encoded, 2, data)
+	}
+	encoded = appendVarintField(encoded, 3, fileSize)
+	for _, blockSize := range blockSizes {
+		encoded = appendVarintField(encoded, 4, blockSize)
+	}
+	return encoded
+}
+
+// encodePBNode encodes a dag-pb node the way the daemon does:
+// the Links (2) come before the Data (1), and every link has Hash (1), an empty Name (2) and Tsize (3).
+func encodePBNode(links []dagNode, data []byte) []byte {
+	var encoded []byte
+	for _, link := range links {
+		encodedLink := appendBytesField(nil, 1, link.cid.Bytes())
+		encodedLink = appendBytesField(encodedLink, 2, nil)
+		encodedLink = appendVarintField(encodedLink, 3, link.treeSize)
+		encoded = appendBytesField(encoded, 2, encodedLink)
+	}
+	return appendBytesField(encoded, 1, data)
+}
+
+// appendVarintField appends a protobuf varint field.
+func appendVarintField(buf []byte, field int, value uint64) []byte {
+	buf = appendVarint(buf, uint64(field)<<3)
+	return appendVarint(buf, value)
+}
+
+// appendBytesField appends a protobuf length delimited field.
+func appendBytesField(buf []byte, field int, value []byte) []byte {
+	buf = appendVarint(buf, uint64(field)<<3|2)
+	buf = appendVarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// appendVarint appends value as an unsigned varint.
+func appendVarint(buf []byte, value uint64) []byte {
+	var encoded [binary.MaxVarintLen64]byte
+	return append(buf, encoded[:binary.PutUvarint(encoded[:], value)]...)
+}
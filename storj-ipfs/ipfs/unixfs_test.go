@@ -0,0 +1,75 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package ipfs
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// patternReader returns size bytes of a linear congruential sequence,
+// so large inputs need no memory and can be reproduced outside Go.
+type patternReader struct {
+	state uint32
+	size  int64
+}
+
+// newPatternReader returns the size bytes of the sequence.
+func newPatternReader(size int64) *patternReader {
+	return &patternReader{state: 1, size: size}
+}
+
+// Read fills p with the next bytes of the sequence.
+func (reader *patternReader) Read(p []byte) (int, error) {
+	if reader.size == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > reader.size {
+		p = p[:reader.size]
+	}
+	for i := range p {
+		reader.state = reader.state*1664525 + 1013904223
+		p[i] = byte(reader.state >> 24)
+	}
+	reader.size -= int64(len(p))
+	return len(p), nil
+}
+
+func TestComputeCIDGolden(t *testing.T) {
+	// The CIDs "ipfs add --only-hash" gives the data, with "--cid-version=1" for v1 and
+	// "--chunker=size-1024" for 1 KiB leaves, as computed by the importer of the daemon
+	// (boxo v0.12.0). The last leaf is half full. 174 leaves fill a node, 175 need a second
+	// level, and 174²+1 leaves need a third.
+	for _, test := range []struct {
+		leaves    int64
+		chunkSize int
+		v0, v1    string
+	}{
+		{1, DefaultChunkSize, "QmP1LveokGpa1xGUgFTsw6HjTc9AvYZ8gh3DsuM2vAqjx1", "bafkreihbjolftwbd6crs67um3krpky5ss62fllngfnhpfrhfcterzq2qfm"},
+		{2, DefaultChunkSize, "QmYWQ4XVdk5rYAJMANGBNhQsQX7voyM7RaaYk57KLX1Vjd", "bafybeibvxna6hcu3ohtn45z6ybvcj3wfgugkdvgnxah7kpmjqhpmixida4"},
+		{174, DefaultChunkSize, "QmQFbdRaXzpfXBUZizLpSXNLxVCFF4Ciuyf6ybmkVkYwRA", "bafybeidvi5jghhmvhiyhhlklafvp3wc7wcts722ebqtkclrqzs2rbznjqa"},
+		{175, DefaultChunkSize, "QmbFduYnoH2B2eFjxN8ortNGJRyp3Qp3riibHKNrmZppGD", "bafybeihlfwcjbbc6krfkjxd34uavlf7k66bwy2sxrb6ocxpcusbruovgsm"},
+		{175, 1024, "Qmdnt6JPTTK4kbKTeJhzbcA46f1Q76s5cpSVgNDZygw1GS", "bafybeiavb3dhlr35xs4jab6whzchwkgdwlhguiocid73krcj5vofch7ik4"},
+		{DefaultLinksPerBlock*DefaultLinksPerBlock + 1, 1024, "QmbdXgYEuK18Dr6jsXLJuJEXMMdUAjXSBHpxiGYfaye84A", "bafybeifmx2dsvouliy4lgumxq7p5yakgzdgprn7pg4uc6wobojhmruau5y"},
+	} {
+		size := (test.leaves-1)*int64(test.chunkSize) + int64(test.chunkSize/2)
+		for version, expected := range []string{test.v0, test.v1} {
+			hash, err := computeCID(newPatternReader(size), version, test.chunkSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != expected {
+				t.Errorf("%d leaves of %d bytes, CIDv%d: %s, expected %s", test.leaves, test.chunkSize, version, hash, expected)
+			}
+		}
+	}
+
+	// No data is a single empty leaf.
+	for version, expected := range []string{"QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH", "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"} {
+		if hash, err := ComputeCID(strings.NewReader(""), version); err != nil || hash != expected {
+			t.Errorf("empty data, CIDv%d: %s, expected %s: %v", version, hash, expected, err)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package logging is the leveled, structured logger of the ipfs, storj and connector packages.
+// Each record is a message with fields, written as a line of text or as a JSON object.
+// Secrets are never written: fields made with Secret, and fields named after the secret
+// settings, such as apiKey or encryptionPassphrase, show Redacted instead of their value.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	errs "storj-ipfs/errs"
+)
+
+// Level is the severity of a record.
+type Level int
+
+// Levels, from the most to the least detailed.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// levelNames are the names of the levels, as written and as parsed by ParseLevel.
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the name of level.
+func (level Level) String() string {
+	if level < LevelDebug || level > LevelError {
+		return "level(" + strconv.Itoa(int(level)) + ")"
+	}
+	return levelNames[level]
+}
+
+// ParseLevel returns the level named value: "debug", "info", "warn" or "error".
+func ParseLevel(value string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(value, name) {
+			return Level(level), nil
+		}
+	}
+	return LevelInfo, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("Invalid log level %q", value))
+}
+
+// Format is the encoding of the records.
+type Format int
+
+// Formats: a line of text with the fields as key=value, or a JSON object per line.
+const (
+	FormatText Format = iota
+	FormatJSON
+)
+
+// ParseFormat returns the format named value: "text" or "json".
+func ParseFormat(value string) (Format, error) {
+	switch strings.ToLower(value) {
+	case "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return FormatText, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("Invalid log format %q", value))
+}
+
+// Redacted replaces the value of secret fields.
+const Redacted = "[REDACTED]"
+
+// secretKeys are the lowercased names of the fields that are always redacted.
+var secretKeys = map[string]bool{
+	"apikey":               true,
+	"encryptionpassphrase": true,
+	"passphrase":           true,
+	"serializedscope":      true,
+	"scope":                true,
+	"key":                  true,
+	"datakey":              true,
+	"dedupsecret":          true,
+	"secret":               true,
+	"password":             true,
+	"token":                true,
+}
+
+// Field is a named value of a record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Any returns the field key with value.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err returns the field "error" with the message of err.
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// Secret returns the field key of a secret, which only shows whether value is set.
+func Secret(key string, value string) Field {
+	if value == "" {
+		return Field{Key: key, Value: ""}
+	}
+	return Field{Key: key, Value: Redacted}
+}
+
+// Logger writes the records of its level and above to a writer, with its fields added to each.
+// The nil *Logger discards every record, so packages log without checking for one.
+// A Logger is safe for concurrent use.
+type Logger struct {
+	core   *core
+	fields []Field
+}
+
+// core is the writer and settings shared by a logger and the loggers derived from it with With.
+type core struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  Level
+	format Format
+}
+
+// New returns a logger writing the records of level and above to out in format.
+func New(out io.Writer, level Level, format Format) *Logger {
+	return &Logger{core: &core{out: out, level: level, format: format}}
+}
+
+// SetLevel changes the level of logger and of the loggers derived from it.
+func (logger *Logger) SetLevel(level Level) {
+	if logger == nil {
+		return
+	}
+	logger.core.mu.Lock()
+	defer logger.core.mu.Unlock()
+	logger.core.level = level
+}
+
+// SetFormat changes the format of logger and of the loggers derived from it.
+func (logger *Logger) SetFormat(format Format) {
+	if logger == nil {
+		return
+	}
+	logger.core.mu.Lock()
+	defer logger.core.mu.Unlock()
+	logger.core.format = format
+}
+
+// Enabled reports whether logger writes records of level.
+func (logger *Logger) Enabled(level Level) bool {
+	if logger == nil {
+		return false
+	}
+	logger.core.mu.Lock()
+	defer logger.core.mu.Unlock()
+	return level >= logger.core.level
+}
+
+// With returns a logger adding fields to every record of logger.
+func (logger *Logger) With(fields ...Field) *Logger {
+	if logger == nil {
+		return nil
+	}
+	all := make([]Field, 0, len(logger.fields)+len(fields))
+	all = append(append(all, logger.fields...), fields...)
+	return &Logger{core: logger.core, fields: all}
+}
+
+// Debug writes a record of detailed progress.
+func (logger *Logger) Debug(message string, fields ...Field) {
+	logger.log(LevelDebug, message, fields)
+}
+
+// Info writes a record of regular progress.
+func (logger *Logger) Info(message string, fields ...Field) {
+	logger.log(LevelInfo, message, fields)
+}
+
+// Warn writes a record of a problem that was handled, such as a retried request.
+func (logger *Logger) Warn(message string, fields ...Field) {
+	logger.log(LevelWarn, message, fields)
+}
+
+// Error writes a record of a failure.
+func (logger *Logger) Error(message string, fields ...Field) {
+	logger.log(LevelError, message, fields)
+}
+
+// log writes a record of level, if enabled, as a single write to the output.
+func (logger *Logger) log(level Level, message string, fields []Field) {
+	if logger == nil {
+		return
+	}
+	logger.core.mu.Lock()
+	defer logger.core.mu.Unlock()
+	if level < logger.core.level {
+		return
+	}
+
+	all := append(append(make([]Field, 0, len(logger.fields)+len(fields)), logger.fields...), fields...)
+	var line bytes.Buffer
+	if logger.core.format == FormatJSON {
+		encodeJSON(&line, time.Now(), level, message, all)
+	} else {
+		encodeText(&line, time.Now(), level, message, all)
+	}
+	logger.core.out.Write(line.Bytes())
+}
+
+// timeFormat is the format of the time of a record: RFC 3339 with milliseconds.
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// encodeText writes a record as its time, level and message, followed by key=value fields.
+func encodeText(line *bytes.Buffer, now time.Time, level Level, message string, fields []Field) {
+	line.WriteString(now.Format(timeFormat))
+	line.WriteByte(' ')
+	line.WriteString(strings.ToUpper(level.String()))
+	line.WriteByte(' ')
+	line.WriteString(message)
+	for _, field := range fields {
+		line.WriteByte(' ')
+		line.WriteString(field.Key)
+		line.WriteByte('=')
+		text := fmt.Sprint(fieldValue(field))
+		if text == "" || strings.ContainsAny(text, " \t\r\n\"=") {
+			text = strconv.Quote(text)
+		}
+		line.WriteString(text)
+	}
+	line.WriteByte('\n')
+}
+
+// encodeJSON writes a record as a JSON object with the time, level, message and fields as members.
+func encodeJSON(line *bytes.Buffer, now time.Time, level Level, message string, fields []Field) {
+	line.WriteString(`{"time":`)
+	writeJSON(line, now.Format(timeFormat))
+	line.WriteString(`,"level":`)
+	writeJSON(line, level.String())
+	line.WriteString(`,"msg":`)
+	writeJSON(line, message)
+	for _, field := range fields {
+		line.WriteByte(',')
+		writeJSON(line, field.Key)
+		line.WriteByte(':')
+		writeJSON(line, fieldValue(field))
+	}
+	line.WriteString("}\n")
+}
+
+// writeJSON writes value as JSON, or as the JSON string of its text if it cannot be encoded.
+func writeJSON(line *bytes.Buffer, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	line.Write(data)
+}
+
+// fieldValue returns the value written for field: Redacted for a set secret,
+// and the text of errors and values with a String method.
+func fieldValue(field Field) interface{} {
+	if secretKeys[strings.ToLower(field.Key)] {
+		if text, ok := field.Value.(string); ok && (text == "" || text == Redacted) {
+			return text
+		}
+		return Redacted
+	}
+	switch value := field.Value.(type) {
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	}
+	return field.Value
+}
+
+// contextKey is the key of the logger in a context.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying logger, for the functions ctx is passed to.
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or nil, which discards every record.
+func FromContext(ctx context.Context) *Logger {
+	logger, _ := ctx.Value(contextKey{}).(*Logger)
+	return logger
+}
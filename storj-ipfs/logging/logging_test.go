@@ -0,0 +1,83 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	const (
+		apiKey     = "13Yqe3oHi5dcnGhMu2ru3cmePC9iEYv6nDrYMbLRh4wre1KtVA9SFwLNAuuvWwc43b9swRsrfsnrbuTHQ6TJKVt4LjGnaARN9PhxJEu"
+		passphrase = "correct horse battery staple"
+		scope      = "134Vgt6GotBasNnMb9dUwCW4Vo1RnDGtvVyAy3GczuncTg2XEF2vUQgKGBdWtwxB1X5hxuGVrTLd6wS7TJXwDcVKyJ86u1MDKJ"
+	)
+	for _, format := range []Format{FormatText, FormatJSON} {
+		var out bytes.Buffer
+		logger := New(&out, LevelDebug, format)
+
+		logger.Info("Secrets", Secret("apiKey", apiKey), Secret("encryptionPassphrase", passphrase), Secret("serializedScope", scope))
+		// Fields named after a secret setting are redacted whatever their case, constructor or type.
+		logger.Info("Settings", Any("APIKey", apiKey), Any("passphrase", passphrase), Any("scope", scope), Any("key", []byte(apiKey)), Any("secret", errors.New(passphrase)))
+		logger.With(Any("encryptionPassphrase", passphrase)).Debug("Derived", Any("serializedScope", scope), Any("dataKey", apiKey))
+		logger.Warn("Unset", Secret("apiKey", ""), Any("passphrase", ""))
+
+		logged := out.String()
+		for _, secret := range []string{apiKey, passphrase, scope, apiKey[:20], "horse"} {
+			if strings.Contains(logged, secret) {
+				t.Errorf("format %d: %q logged in %s", format, secret, logged)
+			}
+		}
+		if count := strings.Count(logged, Redacted); count != 11 {
+			t.Errorf("format %d: %d values redacted, expected 11: %s", format, count, logged)
+		}
+
+		if format == FormatJSON {
+			lines := strings.Split(strings.TrimSpace(logged), "\n")
+			if len(lines) != 4 {
+				t.Fatalf("%d records, expected 4", len(lines))
+			}
+			var record map[string]interface{}
+			if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+				t.Fatal(err)
+			}
+			if record["msg"] != "Secrets" || record["apiKey"] != Redacted || record["encryptionPassphrase"] != Redacted || record["serializedScope"] != Redacted {
+				t.Errorf("record %v", record)
+			}
+			record = nil
+			if err := json.Unmarshal([]byte(lines[3]), &record); err != nil {
+				t.Fatal(err)
+			}
+			// An unset secret shows that it is unset.
+			if record["apiKey"] != "" || record["passphrase"] != "" {
+				t.Errorf("record %v", record)
+			}
+		} else if !strings.Contains(logged, `apiKey="" passphrase=""`) {
+			t.Errorf("unset secrets logged as %s", logged)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, LevelInfo, FormatText).With(Any("path", "dir/a b.txt"))
+	logger.Debug("Hidden")
+	logger.Info("Uploaded", Any("size", 10), Err(errors.New("failed")))
+
+	logged := out.String()
+	if strings.Contains(logged, "Hidden") {
+		t.Errorf("debug record logged at info: %s", logged)
+	}
+	if !strings.Contains(logged, `INFO Uploaded path="dir/a b.txt" size=10 error=failed`) {
+		t.Errorf("logged %s", logged)
+	}
+
+	// The nil logger discards records.
+	var discard *Logger
+	discard.With(Any("path", "a")).Error("Discarded")
+}
@@ -0,0 +1,310 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	errs "storj-ipfs/errs"
+	logging "storj-ipfs/logging"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// DedupPrefix is the prefix below the upload path that shared chunks are stored under.
+const DedupPrefix = "chunks/"
+
+// DedupRefsPrefix is the prefix below DedupPrefix that the references of each stored CID are kept under.
+const DedupRefsPrefix = "refs/"
+
+// dedupRefsVersion is the version of the reference objects.
+const dedupRefsVersion = 1
+
+// dedupSaltInfo, dedupIDInfo and dedupKeyInfo separate the derivations from the dedup secret;
+// the bucket name is appended to the salt and the chunk digest to the key info.
+const (
+	dedupSaltInfo = "storj-ipfs dedup salt"
+	dedupIDInfo   = "storj-ipfs dedup id"
+	dedupKeyInfo  = "storj-ipfs dedup key"
+)
+
+// DedupEntry describes the references to a shared chunk.
+type DedupEntry struct {
+	// Refs counts the chunks of completed stores that reference the shared chunk.
+	Refs int `json:"refs"`
+	// EncryptedSize is the size of the shared chunk object.
+	EncryptedSize int64 `json:"encryptedSize"`
+}
+
+// dedupRefs is the reference object of a stored CID: the shared chunks its manifest references.
+type dedupRefs struct {
+	Version int                   `json:"version"`
+	Chunks  map[string]DedupEntry `json:"chunks"`
+}
+
+// Dedup stores chunks once per bucket and user secret, however many files contain them.
+// A shared chunk is named after a keyed hash of its content and sealed with a convergent key
+// derived from the secret and its content, so equal chunks map to the same object while
+// users with different secrets share nothing. Every manifest chunk carries the convergent key
+// sealed with its own chunk key, so a shareable hash only gives access to its own chunks.
+//
+// The references of each stored CID are kept in their own object below DedupRefsPrefix,
+// written once per store, so concurrent stores never overwrite each other's references.
+// Garbage collection counts references with CountDedupRefs.
+type Dedup struct {
+	// Prefix is the object prefix of the shared chunks, ending in DedupPrefix.
+	Prefix string
+
+	idKey  []byte
+	keyKey []byte
+
+	mu    sync.Mutex
+	known map[string]DedupEntry
+	added map[string]DedupEntry
+}
+
+// DedupSecretKey stretches the dedup secret with Argon2id into the key shared chunks
+// are derived from. The salt is fixed per bucket, so the same secret always gives the same key.
+func DedupSecretKey(secret string, bucket string) ([]byte, error) {
+	if secret == "" {
+		return nil, errors.New("dedup secret must not be empty")
+	}
+	salt := sha256.Sum256([]byte(dedupSaltInfo + bucket))
+	return deriveKey(secret, salt[:kdfSaltSize], DefaultKDFParams), nil
+}
+
+// OpenDedup returns the deduplication state for the shared chunks below prefix,
+// listing the chunks already in store.
+func OpenDedup(ctx context.Context, store ObjectStore, prefix string, secretKey []byte) (*Dedup, error) {
+	if len(secretKey) != DataKeySize {
+		return nil, fmt.Errorf("invalid dedup key size %d", len(secretKey))
+	}
+	dedup := &Dedup{Prefix: prefix, added: make(map[string]DedupEntry)}
+	for _, derived := range []struct {
+		key  *[]byte
+		info string
+	}{{&dedup.idKey, dedupIDInfo}, {&dedup.keyKey, dedupKeyInfo}} {
+		*derived.key = make([]byte, DataKeySize)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, secretKey, nil, []byte(derived.info)), *derived.key); err != nil {
+			return nil, err
+		}
+	}
+
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("could not list shared chunks: %w", err)
+	}
+	dedup.known = make(map[string]DedupEntry, len(objects))
+	for _, object := range objects {
+		if id := strings.TrimPrefix(object.Path, prefix); isChunkID(id) {
+			dedup.known[id] = DedupEntry{EncryptedSize: object.Size}
+		}
+	}
+	return dedup, nil
+}
+
+// isChunkID reports whether name is the name of a shared chunk, as returned by chunkID,
+// rather than a reference object or any other object below the prefix.
+func isChunkID(name string) bool {
+	if len(name) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// chunkID returns the name of the shared chunk with the given plaintext digest:
+// hex encoded HMAC-SHA256 of the digest under the secret's ID key.
+func (dedup *Dedup) chunkID(digest []byte) string {
+	mac := hmac.New(sha256.New, dedup.idKey)
+	mac.Write(digest)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// chunkKey derives the convergent key of the shared chunk with the given plaintext digest.
+func (dedup *Dedup) chunkKey(digest []byte) ([]byte, error) {
+	key := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, dedup.keyKey, nil, append([]byte(dedupKeyInfo), digest...)), key); err != nil {
+		return nil, fmt.Errorf("could not derive shared chunk key: %v", err)
+	}
+	return key, nil
+}
+
+// lookup returns the entry of a shared chunk stored before or during this upload.
+func (dedup *Dedup) lookup(id string) (DedupEntry, bool) {
+	dedup.mu.Lock()
+	defer dedup.mu.Unlock()
+
+	if entry, ok := dedup.added[id]; ok {
+		return entry, true
+	}
+	entry, ok := dedup.known[id]
+	return entry, ok
+}
+
+// addRef records a reference to a shared chunk, to be saved by Save.
+func (dedup *Dedup) addRef(id string, encryptedSize int64) {
+	dedup.mu.Lock()
+	defer dedup.mu.Unlock()
+
+	entry := dedup.added[id]
+	entry.Refs++
+	entry.EncryptedSize = encryptedSize
+	dedup.added[id] = entry
+}
+
+// Save stores the references recorded by this upload as the reference object of baseCID,
+// replacing the references of an earlier store of the same CID.
+// Uploading the object is retried as retry allows.
+func (dedup *Dedup) Save(ctx context.Context, store ObjectStore, baseCID string, retry RetryPolicy) error {
+	dedup.mu.Lock()
+	defer dedup.mu.Unlock()
+
+	data, err := json.Marshal(dedupRefs{Version: dedupRefsVersion, Chunks: dedup.added})
+	if err != nil {
+		return err
+	}
+	if err := uploadObject(ctx, store, dedup.Prefix+DedupRefsPrefix+baseCID, data, retry); err != nil {
+		return fmt.Errorf("could not save shared chunk references: %w", err)
+	}
+	for id, entry := range dedup.added {
+		dedup.known[id] = DedupEntry{EncryptedSize: entry.EncryptedSize}
+	}
+	dedup.added = make(map[string]DedupEntry)
+	return nil
+}
+
+// CountDedupRefs adds up the reference objects below prefix, the DedupPrefix of an upload path,
+// and returns the references to every referenced shared chunk. A shared chunk missing from
+// the result is referenced by no stored CID.
+func CountDedupRefs(ctx context.Context, store ObjectStore, prefix string) (map[string]DedupEntry, error) {
+	objects, err := store.List(ctx, prefix+DedupRefsPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("could not list shared chunk references: %w", err)
+	}
+	counts := make(map[string]DedupEntry)
+	for _, object := range objects {
+		refs, err := readDedupRefs(ctx, store, object.Path)
+		if err != nil {
+			return nil, err
+		}
+		for id, entry := range refs.Chunks {
+			count := counts[id]
+			count.Refs += entry.Refs
+			count.EncryptedSize = entry.EncryptedSize
+			counts[id] = count
+		}
+	}
+	return counts, nil
+}
+
+// readDedupRefs reads the reference object at path.
+func readDedupRefs(ctx context.Context, store ObjectStore, path string) (*dedupRefs, error) {
+	strm, err := store.Get(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read shared chunk references: %w", err)
+	}
+	defer strm.Close()
+	data, err := ioutil.ReadAll(strm)
+	if err != nil {
+		return nil, fmt.Errorf("could not read shared chunk references: %w", err)
+	}
+
+	var refs dedupRefs
+	if err := json.Unmarshal(data, &refs); err != nil {
+		return nil, fmt.Errorf("invalid shared chunk references %q: %v", path, err)
+	}
+	if refs.Version != dedupRefsVersion {
+		return nil, fmt.Errorf("unsupported shared chunk references version %d", refs.Version)
+	}
+	return &refs, nil
+}
+
+// uploadSharedChunk stores job, read from plaintext, as a shared chunk unless it is already stored,
+// and returns its manifest entry with the convergent key sealed under the chunk key.
+func uploadSharedChunk(ctx context.Context, store ObjectStore, plaintext *io.SectionReader, job chunkJob, options UploadOptions) (ManifestChunk, error) {
+	dedup := options.Dedup
+	id := dedup.chunkID(job.digest)
+	object := dedup.Prefix + id
+
+	sharedKey, err := dedup.chunkKey(job.digest)
+	if err != nil {
+		return ManifestChunk{}, err
+	}
+	key, err := ChunkKey(options.DataKey, job.index)
+	if err != nil {
+		return ManifestChunk{}, err
+	}
+	sealedKey, err := Seal(options.Algorithm, key, uint64(job.index), sharedKey)
+	if err != nil {
+		return ManifestChunk{}, fmt.Errorf("could not encrypt key of chunk %d: %v", job.index, err)
+	}
+
+	// A chunk not listed when the upload started may have been uploaded by a concurrent store since.
+	entry, ok := dedup.lookup(id)
+	if !ok {
+		if info, err := store.Stat(ctx, object); err == nil {
+			entry, ok = DedupEntry{EncryptedSize: info.Size}, true
+		}
+	}
+	logger := logging.FromContext(ctx).With(logging.Any("chunk", job.index), logging.Any("object", object))
+	if ok {
+		logger.Debug("Skipping chunk already stored")
+	} else {
+		// Shared chunks are sealed as chunk 0, as they can be at any index of a file.
+		seal := func() (io.Reader, error) {
+			sealed, _, err := SealStream(options.Algorithm, sharedKey, 0, plaintext, job.digest)
+			return sealed, err
+		}
+		_, encryptedSize, err := SealStream(options.Algorithm, sharedKey, 0, plaintext, job.digest)
+		if err != nil {
+			return ManifestChunk{}, fmt.Errorf("could not encrypt chunk %d: %v", job.index, err)
+		}
+		logger.Debug("Uploading chunk", logging.Any("size", encryptedSize))
+		if err := uploadStream(ctx, store, object, seal, options.Retry); err != nil {
+			return ManifestChunk{}, fmt.Errorf("could not upload chunk %d: %w", job.index, err)
+		}
+		logger.Debug("Uploaded chunk")
+		entry.EncryptedSize = encryptedSize
+	}
+	dedup.addRef(id, entry.EncryptedSize)
+
+	return ManifestChunk{
+		CID:           id,
+		Offset:        job.offset,
+		Size:          job.size,
+		EncryptedSize: entry.EncryptedSize,
+		Digest:        hex.EncodeToString(job.digest),
+		Object:        object,
+		SharedKey:     base64.StdEncoding.EncodeToString(sealedKey),
+	}, nil
+}
+
+// openSharedKey opens the convergent key of a shared chunk with its chunk key.
+func openSharedKey(dataKey []byte, index int, chunk ManifestChunk) ([]byte, error) {
+	sealedKey, err := base64.StdEncoding.DecodeString(chunk.SharedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key of chunk %d: %v", index, err)
+	}
+	key, err := ChunkKey(dataKey, index)
+	if err != nil {
+		return nil, err
+	}
+	sharedKey, err := Open(key, uint64(index), sealedKey)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrDecrypt, err, "Could not decrypt key of chunk %d", index)
+	}
+	return sharedKey, nil
+}
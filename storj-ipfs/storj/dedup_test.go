@@ -0,0 +1,86 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDedupRefs(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	prefix := testUploadPath + DedupPrefix
+	secretKey := bytes.Repeat([]byte{7}, DataKeySize)
+	// Objects below the prefix that are not named like shared chunks are not listed as stored chunks.
+	if err := store.Put(ctx, prefix+"notes.txt", strings.NewReader("not a chunk")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Four equal chunks, and two of them followed by a chunk of their own.
+	chunk := testData(8, testChunkSize)
+	first := bytes.Repeat(chunk, 4)
+	second := append(bytes.Repeat(chunk, 2), testData(9, testChunkSize)...)
+
+	upload := func(dedup *Dedup, baseCID string, data []byte) {
+		dataKey, err := NewDataKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		options := UploadOptions{
+			Prefix:    testUploadPath + baseCID + "/",
+			Algorithm: AlgorithmAESGCM,
+			DataKey:   dataKey,
+			ChunkCID:  testChunkCID,
+			Dedup:     dedup,
+		}
+		chunks, err := UploadChunks(ctx, store, bytes.NewReader(data), testBoundaries(data), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dedup.Save(ctx, store, baseCID, RetryPolicy{}); err != nil {
+			t.Fatal(err)
+		}
+		downloaded := &bytes.Buffer{}
+		if _, err := downloaded.ReadFrom(StreamChunks(ctx, store, chunks, options.Prefix, dataKey, RetryPolicy{})); err != nil || !bytes.Equal(downloaded.Bytes(), data) {
+			t.Fatalf("%s: download differs from the upload: %v", baseCID, err)
+		}
+	}
+	open := func() *Dedup {
+		dedup, err := OpenDedup(ctx, store, prefix, secretKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dedup
+	}
+
+	// Two stores running at the same time keep each other's references.
+	firstDedup, secondDedup := open(), open()
+	upload(firstDedup, "QmFirst", first)
+	upload(secondDedup, "QmSecond", second)
+	checkRefs := func(expected int) {
+		counts, err := CountDedupRefs(ctx, store, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs := 0
+		for _, entry := range counts {
+			refs += entry.Refs
+		}
+		if len(counts) != 2 || refs != expected {
+			t.Fatalf("%d references to %d chunks, expected %d to 2", refs, len(counts), expected)
+		}
+	}
+	checkRefs(7)
+
+	// Storing a CID again replaces its references, and the chunks it shares are listed as stored.
+	dedup := open()
+	if len(dedup.known) != 2 {
+		t.Fatalf("%d shared chunks listed, expected 2", len(dedup.known))
+	}
+	upload(dedup, "QmFirst", first[:2*testChunkSize])
+	checkRefs(5)
+}
@@ -0,0 +1,162 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DirStore is an ObjectStore that keeps each object as a file below a local directory.
+// Object paths map to file paths relative to the root, so "a/b/c" is stored at root/a/b/c.
+type DirStore struct {
+	root string
+}
+
+// NewDirStore returns an ObjectStore rooted at root, creating the directory if needed.
+func NewDirStore(root string) (*DirStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &DirStore{root: root}, nil
+}
+
+// Put writes data to the file for path, replacing it only once fully written.
+func (store *DirStore) Put(ctx context.Context, path string, data io.Reader) error {
+	fullPath, err := store.filePath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(filepath.Dir(fullPath), ".put-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tempFile, data); err != nil {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempFile.Name())
+		return err
+	}
+	return os.Rename(tempFile.Name(), fullPath)
+}
+
+// Get opens the file for path.
+func (store *DirStore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	return store.GetRange(ctx, path, 0, -1)
+}
+
+// GetRange opens the file for path and returns a reader over the requested range.
+func (store *DirStore) GetRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	fullPath, err := store.filePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(fullPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%q: %w", path, ErrObjectNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return &limitedFile{Reader: io.LimitReader(file, length), file: file}, nil
+}
+
+// Stat returns the size and modification time of the file for path.
+func (store *DirStore) Stat(ctx context.Context, path string) (ObjectInfo, error) {
+	fullPath, err := store.filePath(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return ObjectInfo{}, fmt.Errorf("%q: %w", path, ErrObjectNotFound)
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Path: path, Size: info.Size(), Modified: info.ModTime()}, nil
+}
+
+// List walks the root directory and returns every file whose object path starts with prefix.
+func (store *DirStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var infos []ObjectInfo
+	err := filepath.Walk(store.root, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".put-") {
+			return nil
+		}
+		rel, err := filepath.Rel(store.root, fullPath)
+		if err != nil {
+			return err
+		}
+		path := filepath.ToSlash(rel)
+		if strings.HasPrefix(path, prefix) {
+			infos = append(infos, ObjectInfo{Path: path, Size: info.Size(), Modified: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+	return infos, nil
+}
+
+// Delete removes the file for path.
+func (store *DirStore) Delete(ctx context.Context, path string) error {
+	fullPath, err := store.filePath(path)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(fullPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%q: %w", path, ErrObjectNotFound)
+	}
+	return err
+}
+
+// filePath maps an object path to a file below the root, rejecting paths that escape it.
+func (store *DirStore) filePath(path string) (string, error) {
+	cleaned := filepath.Clean("/" + filepath.FromSlash(path))
+	if cleaned == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid object path %q", path)
+	}
+	return filepath.Join(store.root, cleaned), nil
+}
+
+// limitedFile closes the underlying file of a ranged read.
+type limitedFile struct {
+	io.Reader
+	file *os.File
+}
+
+// Close closes the underlying file.
+func (reader *limitedFile) Close() error {
+	return reader.file.Close()
+}
@@ -0,0 +1,434 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	errs "storj-ipfs/errs"
+	logging "storj-ipfs/logging"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DownloadData reads the meta file of baseCID from store,
+// downloads and decrypts every chunk it lists with keys derived from dataKey,
+// with up to concurrency chunks in flight, and writes the reassembled file to localPath/fileName.
+// Each chunk download failing with a transient error is retried as retry allows.
+// A stored directory is recreated at localPath/fileName with all its files and subdirectories.
+// Data is written to a partial file that only replaces its target once complete.
+// A sidecar state file records the chunks already written, so a failed download can be
+// repeated and only fetches the chunks that are missing or no longer match the manifest.
+func DownloadData(ctx context.Context, store ObjectStore, localPath string, uploadPath string, baseCID string, fileName string, dataKey []byte, concurrency int, retry RetryPolicy) error {
+	// The file name comes from the pointer, so it is checked like the paths of a directory manifest.
+	fileNameDownload, err := entryTarget(localPath, fileName)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := ReadManifest(ctx, store, uploadPath, baseCID)
+	if err != nil {
+		return err
+	}
+	if manifest.Directory {
+		err = downloadDirectory(ctx, store, manifest, uploadPath+baseCID+"/", fileNameDownload, baseCID, dataKey, concurrency, retry)
+	} else {
+		err = downloadFile(ctx, store, manifest, uploadPath+baseCID+"/", fileNameDownload, baseCID, dataKey, concurrency, retry)
+	}
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("Downloaded file", logging.Any("file", fileName), logging.Any("path", localPath))
+	return nil
+}
+
+// ReadManifest downloads and parses the meta file of baseCID stored below uploadPath.
+func ReadManifest(ctx context.Context, store ObjectStore, uploadPath string, baseCID string) (*Manifest, error) {
+	// Download meta file from storj network.
+	//Get Meta data file from storj
+	strmMeta, err := store.Get(ctx, uploadPath+MetaFileName(baseCID))
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, errs.Wrap(errs.ErrChunkMissing, err, "Missing meta file of %s", baseCID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not initiate download: %w", err)
+	}
+
+	// Read everything from the stream.
+	receivedContentsMeta, err := ioutil.ReadAll(strmMeta)
+	strmMeta.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Could not Read All content in stream: %w", err)
+	}
+
+	return ParseManifest(receivedContentsMeta)
+}
+
+// StreamChunks returns a reader over the plaintext of chunks, downloaded from prefix+CID,
+// decrypted with keys derived from dataKey and verified one at a time in order.
+// A chunk download failing with a transient error is retried as retry allows; a chunk that
+// still fails makes the reader return its error. Closing the reader stops the download.
+func StreamChunks(ctx context.Context, store ObjectStore, chunks []ManifestChunk, prefix string, dataKey []byte, retry RetryPolicy) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		stream := &streamWriter{writer: writer}
+		for index, chunk := range chunks {
+			if _, err := downloadChunk(ctx, store, prefix, dataKey, index, chunk, retry, stream, stream.written); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		writer.Close()
+	}()
+	return reader
+}
+
+// streamWriter passes data written at increasing offsets on to writer in order.
+// Data written again at an offset already passed on, by a retried chunk download,
+// is skipped: chunks are authenticated, so it is the same data.
+type streamWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+// WriteAt writes the part of data past the data already written.
+func (stream *streamWriter) WriteAt(data []byte, offset int64) (int, error) {
+	if offset > stream.written {
+		return 0, fmt.Errorf("write at %d past the %d bytes written", offset, stream.written)
+	}
+	if skip := stream.written - offset; skip < int64(len(data)) {
+		n, err := stream.writer.Write(data[skip:])
+		stream.written += int64(n)
+		if err != nil {
+			return int(skip) + n, err
+		}
+	}
+	return len(data), nil
+}
+
+// downloadDirectory recreates the stored directory described by manifest at root.
+// Files already at their target with the recorded digest are not downloaded again.
+func downloadDirectory(ctx context.Context, store ObjectStore, manifest *Manifest, prefix string, root string, baseCID string, dataKey []byte, concurrency int, retry RetryPolicy) error {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("Could not create directory %q: %v", root, err)
+	}
+
+	logger := logging.FromContext(ctx)
+	for _, entry := range manifest.Entries {
+		target, err := entryTarget(root, entry.Path)
+		if err != nil {
+			return err
+		}
+		if entry.Dir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("Could not create directory %q: %v", target, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("Could not create directory %q: %v", filepath.Dir(target), err)
+		}
+		if digest, err := fileDigest(target); err == nil && entry.Digest != "" && digest == entry.Digest {
+			logger.Info("Skipping file already downloaded", logging.Any("path", entry.Path))
+			continue
+		}
+
+		fileKey, err := FileKey(dataKey, entry.Path)
+		if err != nil {
+			return err
+		}
+		fileManifest := &Manifest{
+			Version:  manifest.Version,
+			FileName: path.Base(entry.Path),
+			FileSize: entry.Size,
+			Mode:     entry.Mode,
+			ModTime:  entry.ModTime,
+			Chunks:   entry.Chunks,
+		}
+		logger.Info("Downloading file", logging.Any("path", entry.Path), logging.Any("size", entry.Size))
+		if err := downloadFile(ctx, store, fileManifest, prefix, target, baseCID+"/"+entry.Path, fileKey, concurrency, retry); err != nil {
+			return fmt.Errorf("Could not download %s: %w", entry.Path, err)
+		}
+	}
+
+	// Restore directory permissions and modification times last, deepest first,
+	// as creating the files inside them changes them.
+	for i := len(manifest.Entries) - 1; i >= 0; i-- {
+		entry := manifest.Entries[i]
+		if !entry.Dir {
+			continue
+		}
+		target, _ := entryTarget(root, entry.Path)
+		restoreAttributes(ctx, target, entry.Mode, entry.ModTime)
+	}
+	restoreAttributes(ctx, root, manifest.Mode, manifest.ModTime)
+	return nil
+}
+
+// downloadFile downloads the chunks listed in manifest into a partial file next to target,
+// which is renamed to target once complete. stateID identifies the file in the partial
+// download's state file, so a partial file of different content is never resumed.
+func downloadFile(ctx context.Context, store ObjectStore, manifest *Manifest, prefix string, target string, stateID string, dataKey []byte, concurrency int, retry RetryPolicy) error {
+	// Write into a partial file next to the target, so the rename is atomic.
+	// The partial file and its state file are kept when the download fails,
+	// so the next download of the same file only fetches the missing chunks.
+	partFileName := filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".part")
+	flags := os.O_RDWR | os.O_CREATE
+	if manifest.Version == 0 {
+		// Legacy manifests carry no digests, so their chunks cannot be verified and are always fetched
+		// into an emptied partial file, which holds nothing of a stale download beyond their end.
+		flags |= os.O_TRUNC
+	}
+	downloadFileDisk, err := os.OpenFile(partFileName, flags, 0600)
+	if err != nil {
+		return fmt.Errorf("Could not open file to write downloaded data: %v", err)
+	}
+
+	var state *DownloadState
+	if manifest.Version > 0 {
+		state = OpenDownloadState(partFileName+".state", stateID)
+		if verified := state.Verify(downloadFileDisk, manifest); verified > 0 {
+			logging.FromContext(ctx).Info("Resuming download", logging.Any("downloaded", verified), logging.Any("chunks", len(manifest.Chunks)))
+		}
+	}
+
+	err = DownloadChunks(ctx, store, manifest, prefix, dataKey, downloadFileDisk, concurrency, state, retry)
+	if err == nil && manifest.Version > 0 {
+		// Drop anything a stale partial file held beyond the end of the file.
+		err = downloadFileDisk.Truncate(manifest.FileSize)
+	}
+	if err == nil {
+		err = downloadFileDisk.Sync()
+	}
+	if closeErr := downloadFileDisk.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if state == nil {
+			os.Remove(partFileName)
+		}
+		return err
+	}
+
+	// Restore the permissions and modification time recorded at upload.
+	restoreAttributes(ctx, partFileName, manifest.Mode, manifest.ModTime)
+
+	if err := os.Rename(partFileName, target); err != nil {
+		return fmt.Errorf("Could not move downloaded data to %q: %v", target, err)
+	}
+	if state != nil {
+		state.Remove()
+	}
+	return nil
+}
+
+// restoreAttributes sets the permissions and modification time recorded in a manifest on fullPath.
+// Files from manifests without a mode get 0644; directories keep their mode.
+// The data is complete at this point, so failures are logged as warnings rather than failing the download.
+func restoreAttributes(ctx context.Context, fullPath string, mode uint32, modTime time.Time) {
+	logger := logging.FromContext(ctx)
+	if mode != 0 {
+		if err := os.Chmod(fullPath, os.FileMode(mode).Perm()); err != nil {
+			logger.Warn("Could not restore permissions", logging.Any("path", fullPath), logging.Err(err))
+		}
+	} else if info, err := os.Stat(fullPath); err == nil && !info.IsDir() {
+		if err := os.Chmod(fullPath, 0644); err != nil {
+			logger.Warn("Could not restore permissions", logging.Any("path", fullPath), logging.Err(err))
+		}
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(fullPath, modTime, modTime); err != nil {
+			logger.Warn("Could not restore modification time", logging.Any("path", fullPath), logging.Err(err))
+		}
+	}
+}
+
+// DownloadChunks downloads, decrypts and verifies every chunk listed in manifest
+// from prefix+CID and writes it at its offset in file, with up to concurrency chunks in flight.
+// Legacy manifests carry no offsets, so their chunks are downloaded one at a time in order.
+// If state is not nil, chunks it records are skipped and every written chunk is recorded in it.
+// Each chunk download failing with a transient error is retried as retry allows.
+func DownloadChunks(ctx context.Context, store ObjectStore, manifest *Manifest, prefix string, dataKey []byte, file io.WriterAt, concurrency int, state *DownloadState, retry RetryPolicy) error {
+	if manifest.Version == 0 {
+		var offset int64
+		for index, chunk := range manifest.Chunks {
+			size, err := downloadChunk(ctx, store, prefix, dataKey, index, chunk, retry, file, offset)
+			if err != nil {
+				return err
+			}
+			offset += size
+		}
+		return nil
+	}
+
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	group, ctx := errgroup.WithContext(ctx)
+	indexes := make(chan int)
+
+	group.Go(func() error {
+		defer close(indexes)
+		for index := range manifest.Chunks {
+			if state != nil && state.Done(index) {
+				continue
+			}
+			select {
+			case indexes <- index:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	for i := 0; i < concurrency; i++ {
+		group.Go(func() error {
+			for index := range indexes {
+				chunk := manifest.Chunks[index]
+				if _, err := downloadChunk(ctx, store, prefix, dataKey, index, chunk, retry, file, chunk.Offset); err != nil {
+					return err
+				}
+				if state != nil {
+					if err := state.Record(index, chunk); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	}
+
+	return group.Wait()
+}
+
+// downloadChunk downloads a single chunk, from prefix+CID or its shared object, and writes
+// its verified plaintext at offset in file, returning its size. Stream envelopes are decrypted
+// and written one segment at a time as they are read; only the older envelopes and unsealed
+// legacy chunks, which are authenticated as a whole, are read whole first.
+// The download is retried as retry allows, writing the chunk again from offset;
+// a chunk that cannot be decrypted or verified is not downloaded again.
+func downloadChunk(ctx context.Context, store ObjectStore, prefix string, dataKey []byte, index int, chunk ManifestChunk, retry RetryPolicy, file io.WriterAt, offset int64) (int64, error) {
+	logger := logging.FromContext(ctx).With(logging.Any("chunk", index), logging.Any("cid", chunk.CID))
+	logger.Debug("Downloading chunk")
+	objectPath := prefix + chunk.CID
+	if chunk.Object != "" {
+		objectPath = chunk.Object
+	}
+
+	chunkKey, err := ChunkKey(dataKey, index)
+	if err != nil {
+		return 0, err
+	}
+	sealedIndex := uint64(index)
+	if chunk.SharedKey != "" {
+		// Shared chunks are sealed as chunk 0 with the key sealed in the manifest.
+		chunkKey, err = openSharedKey(dataKey, index, chunk)
+		if err != nil {
+			return 0, err
+		}
+		sealedIndex = 0
+	}
+	// Only uploads without a data key predate envelopes, so any other chunk without one was altered.
+	open := Open
+	if dataKey == nil {
+		open = openLegacy
+	}
+
+	openChunk := func(sealed io.Reader, write func(plaintext []byte) error) error {
+		reader := bufio.NewReader(sealed)
+		if header, err := reader.Peek(streamHeaderSize); err == nil && isStreamEnvelope(header) {
+			return openStreamFrom(chunkKey, sealedIndex, reader, write)
+		}
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		plaintext, err := open(chunkKey, sealedIndex, data)
+		if err != nil {
+			return err
+		}
+		return write(plaintext)
+	}
+
+	var size int64
+	err = retry.Do(ctx, func(ctx context.Context) error {
+		var err error
+		size, err = readChunk(ctx, store, objectPath, index, chunk, openChunk, file, offset)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	logger.Debug("Downloaded chunk", logging.Any("size", size))
+	return size, nil
+}
+
+// readChunk reads the sealed chunk stored at objectPath and has it opened by open, which passes
+// the plaintext to write in order. The plaintext is written at offset in file, hashed and verified
+// against chunk; its size is returned. Errors reading the object are returned as they are,
+// to be retried, while a chunk that cannot be opened or verified fails with errs.ErrDecrypt.
+func readChunk(ctx context.Context, store ObjectStore, objectPath string, index int, chunk ManifestChunk, open func(sealed io.Reader, write func(plaintext []byte) error) error, file io.WriterAt, offset int64) (int64, error) {
+	strm, err := store.Get(ctx, objectPath)
+	if errors.Is(err, ErrObjectNotFound) {
+		return 0, errs.Wrap(errs.ErrChunkMissing, err, "Missing chunk %d (%s)", index, chunk.CID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Could not initiate download: %w", err)
+	}
+	defer strm.Close()
+
+	sealed := &errorReader{reader: strm}
+	hash := sha256.New()
+	var size int64
+	var writeErr error
+	err = open(sealed, func(plaintext []byte) error {
+		if _, writeErr = file.WriteAt(plaintext, offset+size); writeErr != nil {
+			return writeErr
+		}
+		hash.Write(plaintext)
+		size += int64(len(plaintext))
+		return nil
+	})
+	switch {
+	case sealed.err != nil:
+		return 0, fmt.Errorf("Could not read chunk %d: %w", index, sealed.err)
+	case writeErr != nil:
+		return 0, fmt.Errorf("Could not write downloaded data: %v", writeErr)
+	case err != nil:
+		return 0, errs.Wrap(errs.ErrDecrypt, err, "Could not decrypt chunk %d (%s)", index, chunk.CID)
+	}
+	if err := chunk.verifySum(size, hash.Sum(nil)); err != nil {
+		return 0, errs.Wrap(errs.ErrDecrypt, err, "Could not verify chunk %d", index)
+	}
+	return size, nil
+}
+
+// errorReader records the first error other than io.EOF of the reader it wraps,
+// telling a failed download apart from an envelope that cannot be opened.
+type errorReader struct {
+	reader io.Reader
+	err    error
+}
+
+// Read reads from the wrapped reader.
+func (reader *errorReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	if err != nil && err != io.EOF && reader.err == nil {
+		reader.err = err
+	}
+	return n, err
+}
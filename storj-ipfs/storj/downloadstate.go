@@ -0,0 +1,134 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// DownloadState is the sidecar file kept next to a partial download.
+// It records which chunks have been written to the partial file,
+// so an interrupted download can be continued without fetching them again.
+// Like a Journal, the state file is a log of JSON records, one per line: the first holds
+// the base CID, and each written chunk appends one. Verify compacts the file.
+type DownloadState struct {
+	path string
+	mu   sync.Mutex
+	// created is set once the file at path holds this state, so records are appended to it.
+	created bool
+
+	BaseCID string
+	// Written maps chunk indexes to the chunks written to the partial file.
+	Written map[int]ManifestChunk
+}
+
+// OpenDownloadState loads the download state at path. A missing, unreadable
+// or foreign state file yields an empty state, as the partial file is then restarted.
+// A last record cut short by an interrupted write is ignored.
+func OpenDownloadState(path string, baseCID string) *DownloadState {
+	state := &DownloadState{path: path, BaseCID: baseCID, Written: make(map[int]ManifestChunk)}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return state
+	}
+	defer file.Close()
+
+	written := make(map[int]ManifestChunk)
+	decoder := json.NewDecoder(file)
+	for first := true; ; first = false {
+		var record journalRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil || first && record.BaseCID != baseCID {
+			return state
+		}
+		if record.Chunk != nil {
+			written[record.Index] = *record.Chunk
+		}
+	}
+	state.Written = written
+	return state
+}
+
+// Verify re-reads every chunk recorded as written from file and keeps only those
+// that still match the manifest, returning how many were kept.
+// The state file is rewritten with the kept chunks.
+func (state *DownloadState) Verify(file io.ReaderAt, manifest *Manifest) int {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	for index, written := range state.Written {
+		if index < 0 || index >= len(manifest.Chunks) || manifest.Chunks[index] != written || written.Digest == "" {
+			delete(state.Written, index)
+			continue
+		}
+		hash := sha256.New()
+		size, err := io.Copy(hash, io.NewSectionReader(file, written.Offset, written.Size))
+		if err != nil || written.verifySum(size, hash.Sum(nil)) != nil {
+			delete(state.Written, index)
+		}
+	}
+	// A failed compaction is retried by the first Record.
+	state.save()
+	return len(state.Written)
+}
+
+// Done reports whether the chunk at index has been written.
+func (state *DownloadState) Done(index int) bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	_, ok := state.Written[index]
+	return ok
+}
+
+// Record marks the chunk at index as written, appending it to the state file.
+func (state *DownloadState) Record(index int, chunk ManifestChunk) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.Written[index] = chunk
+	if !state.created {
+		return state.save()
+	}
+	if err := appendRecord(state.path, journalRecord{Index: index, Chunk: &chunk}); err != nil {
+		return fmt.Errorf("could not write download state: %v", err)
+	}
+	return nil
+}
+
+// Remove deletes the state file once the download has completed.
+func (state *DownloadState) Remove() error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	err := os.Remove(state.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// save writes the state, one record per chunk, to a temporary file and renames it over
+// the state file. The caller holds state.mu.
+func (state *DownloadState) save() error {
+	records := []interface{}{journalRecord{BaseCID: state.BaseCID}}
+	for _, index := range sortedIndexes(state.Written) {
+		chunk := state.Written[index]
+		records = append(records, journalRecord{Index: index, Chunk: &chunk})
+	}
+	if err := writeRecords(state.path, records); err != nil {
+		return fmt.Errorf("could not write download state: %v", err)
+	}
+	state.created = true
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadState(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	data := testData(7, 3*testChunkSize)
+	manifest := &Manifest{Version: ManifestVersion, FileSize: int64(len(data))}
+	for index := 0; index < 3; index++ {
+		chunkData := data[index*testChunkSize : (index+1)*testChunkSize]
+		manifest.Chunks = append(manifest.Chunks, ManifestChunk{CID: testBaseCID, Offset: int64(index) * testChunkSize, Size: testChunkSize, Digest: ChunkDigest(chunkData)})
+	}
+	path := filepath.Join(dir, "state")
+
+	state := OpenDownloadState(path, testBaseCID)
+	for index, chunk := range manifest.Chunks {
+		if err := state.Record(index, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(written, []byte("\n")); lines != 4 {
+		t.Fatalf("state file has %d lines, expected 4", lines)
+	}
+
+	// Chunks that no longer match the partial file are dropped, and the file is compacted.
+	partial := append([]byte(nil), data...)
+	partial[testChunkSize] ^= 0xff
+	state = OpenDownloadState(path, testBaseCID)
+	if verified := state.Verify(bytes.NewReader(partial), manifest); verified != 2 {
+		t.Fatalf("verified %d chunks, expected 2", verified)
+	}
+	if state.Done(1) || !state.Done(0) || !state.Done(2) {
+		t.Errorf("chunk 1 should be the only one left to download")
+	}
+	if reopened := OpenDownloadState(path, testBaseCID); len(reopened.Written) != 2 {
+		t.Errorf("compacted state records %d chunks, expected 2", len(reopened.Written))
+	}
+	if foreign := OpenDownloadState(path, "QmOther"); len(foreign.Written) != 0 {
+		t.Errorf("state of %s used for another CID", testBaseCID)
+	}
+}
+
+func TestResumeDownload(t *testing.T) {
+	stores, cleanup := testStores(t)
+	defer cleanup()
+	for name, backend := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			dataKey, err := NewDataKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := testData(3, testFileSize)
+			manifest := storeFile(t, backend, data, dataKey, UploadOptions{Concurrency: 2})
+
+			// The download is interrupted after five chunks.
+			dir, cleanup := tempDir(t)
+			defer cleanup()
+			store := &faultyStore{ObjectStore: backend, getLimit: 5}
+			err = DownloadData(ctx, store, dir, testUploadPath, testBaseCID, testFileName, dataKey, 1, RetryPolicy{Attempts: 1})
+			if !errors.Is(err, errFaulty) {
+				t.Fatalf("interrupted download: %v, expected %v", err, errFaulty)
+			}
+			statePath := filepath.Join(dir, "."+testFileName+".part.state")
+			if _, err := os.Stat(statePath); err != nil {
+				t.Fatalf("no download state after interruption: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, testFileName)); !os.IsNotExist(err) {
+				t.Fatalf("incomplete download at the target: %v", err)
+			}
+
+			// A chunk corrupted in the partial file is fetched again.
+			partFile, err := os.OpenFile(filepath.Join(dir, "."+testFileName+".part"), os.O_RDWR, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := partFile.WriteAt([]byte{0xff, 0xff, 0xff}, manifest.Chunks[2].Offset); err != nil {
+				t.Fatal(err)
+			}
+			partFile.Close()
+
+			store.reset(0, 0)
+			if err := DownloadData(ctx, store, dir, testUploadPath, testBaseCID, testFileName, dataKey, 2, RetryPolicy{}); err != nil {
+				t.Fatal(err)
+			}
+			// Chunks 2 and 5 to 10.
+			if store.gets != 7 {
+				t.Errorf("resumed download fetched %d chunks, expected 7", store.gets)
+			}
+			checkDownload(t, dir, data, manifest)
+			if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+				t.Errorf("download state left after completion: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	errs "storj-ipfs/errs"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrIntegrity is returned when encrypted data fails authentication,
+// meaning it was corrupted or tampered with, or the wrong key was used.
+var ErrIntegrity = errors.New("integrity check failed")
+
+// Algorithm identifies the AEAD used to seal an envelope.
+type Algorithm byte
+
+const (
+	// AlgorithmAESGCM is AES in Galois/Counter Mode with a 96-bit nonce.
+	AlgorithmAESGCM Algorithm = 1
+	// AlgorithmXChaCha20Poly1305 is XChaCha20-Poly1305 with a 192-bit nonce.
+	AlgorithmXChaCha20Poly1305 Algorithm = 2
+)
+
+// envelopeMagic starts every sealed envelope.
+const envelopeMagic = "SIPE"
+
+// envelopeVersion is the current envelope layout:
+// magic | version | algorithm | nonce | ciphertext and tag.
+const envelopeVersion = 1
+
+// envelopeHeaderSize is the size of the header preceding the nonce.
+const envelopeHeaderSize = len(envelopeMagic) + 2
+
+// streamEnvelopeVersion is the layout of envelopes sealed in segments by SealStream:
+// magic | version | algorithm | segment size | nonce prefix | sealed segments.
+const streamEnvelopeVersion = 2
+
+// StreamSegmentSize is the plaintext size of every segment but the last of a stream envelope.
+const StreamSegmentSize = 64 * 1024
+
+// streamHeaderSize is the size of the stream envelope header preceding the nonce prefix.
+const streamHeaderSize = envelopeHeaderSize + 4
+
+// streamNonceSuffixSize is the size of the segment counter and final flag
+// completing the nonce prefix to the nonce of a segment.
+const streamNonceSuffixSize = 5
+
+// streamNonceInfo is the HKDF info of the key deriving nonce prefixes from the plaintext.
+const streamNonceInfo = "storj-ipfs stream nonce"
+
+// ParseAlgorithm returns the algorithm for a cipher name from the configuration.
+// An empty name selects AES-GCM.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch name {
+	case "", "aes-256-gcm", "aes-gcm":
+		return AlgorithmAESGCM, nil
+	case "xchacha20-poly1305":
+		return AlgorithmXChaCha20Poly1305, nil
+	}
+	return 0, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("unknown cipher %q", name))
+}
+
+// newAEAD returns the AEAD for algorithm keyed with key.
+func newAEAD(algorithm Algorithm, key []byte) (cipher.AEAD, error) {
+	switch algorithm {
+	case AlgorithmAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AlgorithmXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	}
+	return nil, fmt.Errorf("unknown cipher algorithm %d", algorithm)
+}
+
+// Seal encrypts and authenticates plaintext with key, returning a versioned envelope.
+// The header and index are bound as associated data, so an envelope only opens
+// with the same key at the same index.
+func Seal(algorithm Algorithm, key []byte, index uint64, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := make([]byte, envelopeHeaderSize+aead.NonceSize(), envelopeHeaderSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(envelope, envelopeMagic)
+	envelope[len(envelopeMagic)] = envelopeVersion
+	envelope[len(envelopeMagic)+1] = byte(algorithm)
+	nonce := envelope[envelopeHeaderSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(envelope, nonce, plaintext, associatedData(envelope, index)), nil
+}
+
+// SealStream returns a reader over the stream envelope sealing plaintext with key, and its size.
+// Plaintext is read and sealed one StreamSegmentSize segment at a time as the envelope is read,
+// so only one plaintext and one sealed segment are held. The nonce prefix is derived from
+// key and digest, the SHA-256 of plaintext, so every reader returned for the same chunk yields
+// the same envelope: it can be read once for its CID and again for every upload attempt.
+// A reader whose plaintext no longer matches digest fails with ErrIntegrity before its last segment.
+// Each segment is bound to its position, to the end of the stream, and like Seal to index.
+func SealStream(algorithm Algorithm, key []byte, index uint64, plaintext *io.SectionReader, digest []byte) (io.Reader, int64, error) {
+	aead, err := newAEAD(algorithm, key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	prefixSize := aead.NonceSize() - streamNonceSuffixSize
+	header := make([]byte, streamHeaderSize+prefixSize)
+	copy(header, envelopeMagic)
+	header[len(envelopeMagic)] = streamEnvelopeVersion
+	header[len(envelopeMagic)+1] = byte(algorithm)
+	binary.BigEndian.PutUint32(header[envelopeHeaderSize:], StreamSegmentSize)
+
+	nonceKey := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte(streamNonceInfo)), nonceKey); err != nil {
+		return nil, 0, err
+	}
+	mac := hmac.New(sha256.New, nonceKey)
+	mac.Write(digest)
+	copy(header[streamHeaderSize:], mac.Sum(nil))
+
+	segments := streamSegments(plaintext.Size(), StreamSegmentSize)
+	size := int64(len(header)) + plaintext.Size() + int64(segments*aead.Overhead())
+	return &sealReader{
+		aead:      aead,
+		ad:        associatedData(header, index),
+		nonce:     make([]byte, aead.NonceSize()),
+		plaintext: plaintext,
+		hash:      sha256.New(),
+		digest:    digest,
+		segments:  segments,
+		pending:   header,
+		buffer:    make([]byte, StreamSegmentSize),
+		sealed:    make([]byte, 0, StreamSegmentSize+aead.Overhead()),
+	}, size, nil
+}
+
+// sealReader reads a stream envelope, reading and sealing the next segment whenever the previous one has been read.
+type sealReader struct {
+	aead      cipher.AEAD
+	ad        []byte
+	nonce     []byte
+	plaintext *io.SectionReader
+	hash      hash.Hash
+	digest    []byte
+	segments  int
+	segment   int
+	pending   []byte
+	buffer    []byte
+	sealed    []byte
+}
+
+// Read copies the sealed bytes not read yet into p.
+func (reader *sealReader) Read(p []byte) (int, error) {
+	for len(reader.pending) == 0 {
+		if reader.segment == reader.segments {
+			return 0, io.EOF
+		}
+		start := int64(reader.segment) * StreamSegmentSize
+		end := start + StreamSegmentSize
+		if end > reader.plaintext.Size() {
+			end = reader.plaintext.Size()
+		}
+		segment := reader.buffer[:end-start]
+		if n, err := reader.plaintext.ReadAt(segment, start); n < len(segment) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, fmt.Errorf("could not read plaintext: %w", err)
+		}
+		reader.hash.Write(segment)
+		final := reader.segment == reader.segments-1
+		if final && !hmac.Equal(reader.hash.Sum(nil), reader.digest) {
+			return 0, fmt.Errorf("plaintext changed while it was being sealed: %w", ErrIntegrity)
+		}
+		segmentNonce(reader.nonce, reader.ad[:len(reader.ad)-8], reader.segment, final)
+		reader.pending = reader.aead.Seal(reader.sealed[:0], reader.nonce, segment, reader.ad)
+		reader.segment++
+	}
+	n := copy(p, reader.pending)
+	reader.pending = reader.pending[n:]
+	return n, nil
+}
+
+// streamSegments returns the number of segments of a stream envelope of size plaintext bytes;
+// an empty plaintext still has one, empty, final segment.
+func streamSegments(size int64, segmentSize int64) int {
+	if size == 0 {
+		return 1
+	}
+	return int((size + segmentSize - 1) / segmentSize)
+}
+
+// segmentNonce sets nonce to the nonce prefix at the end of header,
+// followed by the big-endian segment counter and the final segment flag.
+func segmentNonce(nonce []byte, header []byte, segment int, final bool) {
+	prefixSize := len(nonce) - streamNonceSuffixSize
+	copy(nonce, header[len(header)-prefixSize:])
+	binary.BigEndian.PutUint32(nonce[prefixSize:], uint32(segment))
+	nonce[len(nonce)-1] = 0
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+}
+
+// openStream authenticates and decrypts a stream envelope produced by SealStream.
+func openStream(key []byte, index uint64, envelope []byte) ([]byte, error) {
+	plaintext := make([]byte, 0, len(envelope))
+	err := openStreamFrom(key, index, bytes.NewReader(envelope), func(segment []byte) error {
+		plaintext = append(plaintext, segment...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// openStreamFrom authenticates and decrypts the stream envelope produced by SealStream read
+// from envelope, passing the plaintext of each segment to write in order once it is authenticated,
+// so only one segment is held. The plaintext passed to write is only valid until it returns.
+// As every segment is bound to its position and the last one to the end of the stream,
+// an altered, reordered or truncated envelope fails with ErrIntegrity, though only when its
+// altered segment is reached. Errors reading envelope and errors of write are returned as they are.
+func openStreamFrom(key []byte, index uint64, envelope io.Reader, write func(plaintext []byte) error) error {
+	fixed := make([]byte, streamHeaderSize)
+	if err := readEnvelope(envelope, fixed); err != nil {
+		return err
+	}
+	if !isStreamEnvelope(fixed) {
+		return fmt.Errorf("not a stream envelope: %w", ErrIntegrity)
+	}
+	aead, err := newAEAD(Algorithm(fixed[len(envelopeMagic)+1]), key)
+	if err != nil {
+		return err
+	}
+	// SealStream only writes segments of StreamSegmentSize, which bounds the buffer below.
+	segmentSize := int(binary.BigEndian.Uint32(fixed[envelopeHeaderSize:]))
+	if segmentSize <= 0 || segmentSize > StreamSegmentSize {
+		return fmt.Errorf("invalid stream envelope: %w", ErrIntegrity)
+	}
+	header := make([]byte, streamHeaderSize+aead.NonceSize()-streamNonceSuffixSize)
+	copy(header, fixed)
+	if err := readEnvelope(envelope, header[streamHeaderSize:]); err != nil {
+		return err
+	}
+
+	ad := associatedData(header, index)
+	nonce := make([]byte, aead.NonceSize())
+	sealedSize := segmentSize + aead.Overhead()
+	// One byte past the segment is read to tell whether it is the final one.
+	buffer := make([]byte, sealedSize+1)
+	filled := 0
+	for segment := 0; ; segment++ {
+		n, err := io.ReadFull(envelope, buffer[filled:])
+		filled += n
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return err
+		}
+		size := sealedSize
+		if final {
+			size = filled
+		}
+		segmentNonce(nonce, header, segment, final)
+		plaintext, err := aead.Open(buffer[:0], nonce, buffer[:size], ad)
+		if err != nil {
+			return ErrIntegrity
+		}
+		if err := write(plaintext); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+		buffer[0] = buffer[sealedSize]
+		filled = 1
+	}
+}
+
+// readEnvelope fills part with the next bytes of envelope, failing with ErrIntegrity if it ends first.
+func readEnvelope(envelope io.Reader, part []byte) error {
+	_, err := io.ReadFull(envelope, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("envelope too short: %w", ErrIntegrity)
+	}
+	return err
+}
+
+// isStreamEnvelope reports whether data starts with the header of a stream envelope.
+func isStreamEnvelope(data []byte) bool {
+	return IsEnvelope(data) && data[len(envelopeMagic)] == streamEnvelopeVersion
+}
+
+// Open authenticates and decrypts an envelope produced by Seal or SealStream with the same key and index.
+// Data without an envelope header fails with ErrIntegrity, as it cannot be authenticated.
+func Open(key []byte, index uint64, envelope []byte) ([]byte, error) {
+	if !IsEnvelope(envelope) {
+		return nil, fmt.Errorf("missing envelope header: %w", ErrIntegrity)
+	}
+	if envelope[len(envelopeMagic)] == streamEnvelopeVersion {
+		return openStream(key, index, envelope)
+	}
+	if envelope[len(envelopeMagic)] != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", envelope[len(envelopeMagic)])
+	}
+
+	aead, err := newAEAD(Algorithm(envelope[len(envelopeMagic)+1]), key)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := envelopeHeaderSize + aead.NonceSize()
+	if len(envelope) < headerSize+aead.Overhead() {
+		return nil, fmt.Errorf("envelope too short: %w", ErrIntegrity)
+	}
+
+	plaintext, err := aead.Open(nil, envelope[envelopeHeaderSize:headerSize], envelope[headerSize:], associatedData(envelope[:headerSize], index))
+	if err != nil {
+		return nil, ErrIntegrity
+	}
+	return plaintext, nil
+}
+
+// openLegacy opens data like Open, but decrypts data without an envelope header with the
+// legacy unauthenticated scheme. It must only be used for data that may have been written
+// before envelopes, such as the chunks of uploads without a data key.
+func openLegacy(key []byte, index uint64, data []byte) ([]byte, error) {
+	if !IsEnvelope(data) {
+		return decryptLegacy(key, data)
+	}
+	return Open(key, index, data)
+}
+
+// IsEnvelope reports whether data starts with an envelope header.
+func IsEnvelope(data []byte) bool {
+	return len(data) >= envelopeHeaderSize && bytes.Equal(data[:len(envelopeMagic)], []byte(envelopeMagic))
+}
+
+// associatedData returns the envelope header followed by the big-endian index.
+func associatedData(header []byte, index uint64) []byte {
+	data := make([]byte, len(header)+8)
+	copy(data, header)
+	binary.BigEndian.PutUint64(data[len(header):], index)
+	return data
+}
+
+// decryptLegacy decrypts data written before envelopes:
+// AES-CFB over base64 text, with the IV prepended.
+func decryptLegacy(key, text []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(text) < aes.BlockSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	iv := text[:aes.BlockSize]
+	text = text[aes.BlockSize:]
+	cfb := cipher.NewCFBDecrypter(block, iv)
+	cfb.XORKeyStream(text, text)
+	return base64.StdEncoding.DecodeString(string(text))
+}
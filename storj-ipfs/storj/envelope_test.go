@@ -0,0 +1,228 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	errs "storj-ipfs/errs"
+)
+
+// sealLegacy encrypts plaintext the way chunks were encrypted before envelopes.
+func sealLegacy(t *testing.T, key []byte, plaintext []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := []byte(base64.StdEncoding.EncodeToString(plaintext))
+	sealed := make([]byte, aes.BlockSize+len(text))
+	cipher.NewCFBEncrypter(block, sealed[:aes.BlockSize]).XORKeyStream(sealed[aes.BlockSize:], text)
+	return sealed
+}
+
+func TestOpen(t *testing.T) {
+	key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, algorithm := range []Algorithm{AlgorithmAESGCM, AlgorithmXChaCha20Poly1305} {
+		envelope, err := Seal(algorithm, key, 3, []byte("chunk data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext, err := Open(key, 3, envelope); err != nil || string(plaintext) != "chunk data" {
+			t.Fatalf("algorithm %d: opened %q: %v", algorithm, plaintext, err)
+		}
+		if _, err := Open(key, 4, envelope); !errors.Is(err, ErrIntegrity) {
+			t.Errorf("algorithm %d: opened at another index: %v", algorithm, err)
+		}
+		if _, err := Open(key, 3, envelope[envelopeHeaderSize:]); !errors.Is(err, ErrIntegrity) {
+			t.Errorf("algorithm %d: opened without header: %v", algorithm, err)
+		}
+	}
+
+	legacy := sealLegacy(t, key, []byte("legacy data"))
+	if _, err := Open(key, 0, legacy); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("opened legacy data: %v", err)
+	}
+	if plaintext, err := openLegacy(key, 0, legacy); err != nil || string(plaintext) != "legacy data" {
+		t.Errorf("legacy data opened as %q: %v", plaintext, err)
+	}
+}
+
+func TestSealStream(t *testing.T) {
+	key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, algorithm := range []Algorithm{AlgorithmAESGCM, AlgorithmXChaCha20Poly1305} {
+		for _, size := range []int{0, 1, StreamSegmentSize, StreamSegmentSize + 1, 3*StreamSegmentSize + 77} {
+			data := testData(int64(size), size)
+			digest := sha256.Sum256(data)
+			seal := func(data []byte) ([]byte, error) {
+				sealed, sealedSize, err := SealStream(algorithm, key, 5, io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), digest[:])
+				if err != nil {
+					t.Fatal(err)
+				}
+				envelope, err := ioutil.ReadAll(sealed)
+				if err == nil && int64(len(envelope)) != sealedSize {
+					t.Fatalf("algorithm %d, %d bytes: envelope of %d bytes, expected %d", algorithm, size, len(envelope), sealedSize)
+				}
+				return envelope, err
+			}
+
+			envelope, err := seal(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Every reader of the same chunk yields the same envelope.
+			if again, err := seal(data); err != nil || !bytes.Equal(again, envelope) {
+				t.Fatalf("algorithm %d, %d bytes: sealed again differently: %v", algorithm, size, err)
+			}
+			if plaintext, err := Open(key, 5, envelope); err != nil || !bytes.Equal(plaintext, data) {
+				t.Fatalf("algorithm %d, %d bytes: opened %d bytes: %v", algorithm, size, len(plaintext), err)
+			}
+			if _, err := Open(key, 6, envelope); !errors.Is(err, ErrIntegrity) {
+				t.Errorf("algorithm %d, %d bytes: opened at another index: %v", algorithm, size, err)
+			}
+			// Opened a segment at a time as the envelope is read, however it is read, it yields the same plaintext.
+			var opened []byte
+			err = openStreamFrom(key, 5, iotest.OneByteReader(bytes.NewReader(envelope)), func(segment []byte) error {
+				if len(segment) > StreamSegmentSize {
+					return fmt.Errorf("segment of %d bytes", len(segment))
+				}
+				opened = append(opened, segment...)
+				return nil
+			})
+			if err != nil || !bytes.Equal(opened, data) {
+				t.Fatalf("algorithm %d, %d bytes: opened %d bytes a segment at a time: %v", algorithm, size, len(opened), err)
+			}
+			if size > StreamSegmentSize {
+				if _, err := Open(key, 5, envelope[:len(envelope)-size+StreamSegmentSize]); !errors.Is(err, ErrIntegrity) {
+					t.Errorf("algorithm %d, %d bytes: opened without its last segments: %v", algorithm, size, err)
+				}
+				// An envelope failing to be read is not taken for a truncated one.
+				failing := io.MultiReader(bytes.NewReader(envelope[:len(envelope)/2]), iotest.ErrReader(errFaulty))
+				if err := openStreamFrom(key, 5, failing, func([]byte) error { return nil }); err != errFaulty {
+					t.Errorf("algorithm %d, %d bytes: opened while failing to be read: %v, expected %v", algorithm, size, err, errFaulty)
+				}
+				// Plaintext that changed since its digest was taken is not sealed.
+				changed := append([]byte(nil), data...)
+				changed[0] ^= 0xff
+				if _, err := seal(changed); !errors.Is(err, ErrIntegrity) {
+					t.Errorf("algorithm %d, %d bytes: sealed changed plaintext: %v", algorithm, size, err)
+				}
+			}
+		}
+	}
+}
+
+func TestDownloadRejectsLegacyChunk(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := storeFile(t, store, testData(4, testFileSize), dataKey, UploadOptions{})
+
+	// A chunk replaced by one encrypted with the legacy scheme under its own key cannot be downloaded.
+	chunkKey, err := ChunkKey(dataKey, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced := sealLegacy(t, chunkKey, testData(5, testChunkSize))
+	if err := store.Put(ctx, testUploadPath+testBaseCID+"/"+manifest.Chunks[2].CID, bytes.NewReader(replaced)); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	err = DownloadData(ctx, store, dir, testUploadPath, testBaseCID, testFileName, dataKey, 1, RetryPolicy{})
+	if !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("download of a replaced chunk: %v, expected %v", err, ErrIntegrity)
+	}
+}
+
+// breakingStore fails reading the first Get of every chunk after the bytes given by its limit.
+type breakingStore struct {
+	ObjectStore
+
+	mu     sync.Mutex
+	limit  int64
+	broken map[string]bool
+}
+
+// Get returns a reader of the object, failing after limit bytes the first time.
+func (store *breakingStore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	reader, err := store.ObjectStore.Get(ctx, path)
+	if err != nil || strings.HasSuffix(path, ".txt") {
+		return reader, err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.broken[path] {
+		return reader, nil
+	}
+	store.broken[path] = true
+	return ioutil.NopCloser(io.MultiReader(io.LimitReader(reader, store.limit), iotest.ErrReader(errFaulty))), nil
+}
+
+func TestDownloadInterruptedChunk(t *testing.T) {
+	ctx := context.Background()
+	data := testData(6, 7*StreamSegmentSize+77)
+	options := uploadOptions(t, 1)
+	store := &breakingStore{ObjectStore: NewMemStore(), limit: StreamSegmentSize + 100}
+	chunks, err := UploadChunks(ctx, store, bytes.NewReader(data), &sizeBoundaries{size: 3 * StreamSegmentSize, remaining: int64(len(data))}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry := RetryPolicy{Attempts: 2, Delay: time.Millisecond}
+
+	// Every chunk fails after its first segment was written, and is written again when retried.
+	store.broken = map[string]bool{}
+	downloaded := &bytes.Buffer{}
+	if _, err := downloaded.ReadFrom(StreamChunks(ctx, store, chunks, options.Prefix, options.DataKey, retry)); err != nil || !bytes.Equal(downloaded.Bytes(), data) {
+		t.Fatalf("streamed %d bytes, expected %d: %v", downloaded.Len(), len(data), err)
+	}
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	file, err := os.Create(filepath.Join(dir, testFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	store.broken = map[string]bool{}
+	manifest := &Manifest{Version: ManifestVersion, FileSize: int64(len(data)), Chunks: chunks}
+	if err := DownloadChunks(ctx, store, manifest, options.Prefix, options.DataKey, file, 2, nil, retry); err != nil {
+		t.Fatal(err)
+	}
+	if written, err := ioutil.ReadFile(file.Name()); err != nil || !bytes.Equal(written, data) {
+		t.Fatalf("downloaded %d bytes, expected %d: %v", len(written), len(data), err)
+	}
+
+	// Without retries the read error is returned, not taken for a chunk that cannot be decrypted.
+	store.broken = map[string]bool{}
+	err = DownloadChunks(ctx, store, manifest, options.Prefix, options.DataKey, file, 1, nil, RetryPolicy{Attempts: 1})
+	if !errors.Is(err, errFaulty) || errors.Is(err, errs.ErrDecrypt) {
+		t.Fatalf("interrupted download: %v, expected %v", err, errFaulty)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultJournalDir is the directory upload journals are kept in, relative to the working directory.
+const DefaultJournalDir = ".storj-ipfs-journal"
+
+// Journal records which chunks of a store have been uploaded,
+// so an interrupted store can be resumed without uploading them again.
+// The journal file is a log of JSON records, one per line: the first holds the base CID,
+// and each uploaded chunk appends one, so recording a chunk does not rewrite the file.
+// Opening a journal compacts its file to one record per chunk.
+type Journal struct {
+	path string
+	mu   sync.Mutex
+	// created is set once the file at path holds this journal, so records are appended to it.
+	created bool
+
+	BaseCID string
+	// SealedDataKey is the file's data key sealed with the user's secret,
+	// so resumed chunks are encrypted with the same key as the uploaded ones.
+	SealedDataKey []byte
+	// Chunks maps chunk indexes to the uploaded chunks.
+	Chunks map[int]ManifestChunk
+
+	// entries are the journals of the files of a stored directory.
+	entries []*Journal
+}
+
+// journalRecord is a line of a journal file: the base CID and sealed data key, or an uploaded chunk.
+type journalRecord struct {
+	BaseCID       string         `json:"baseCID,omitempty"`
+	SealedDataKey []byte         `json:"sealedDataKey,omitempty"`
+	Index         int            `json:"index,omitempty"`
+	Chunk         *ManifestChunk `json:"chunk,omitempty"`
+}
+
+// JournalPath returns the journal file in dir for storing baseCID with the given settings.
+// Any change to the settings selects a different journal.
+func JournalPath(dir string, baseCID string, settings ...string) string {
+	sum := sha256.Sum256([]byte(baseCID + "\n" + strings.Join(settings, "\n")))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])+".jsonl")
+}
+
+// NewJournal returns an empty journal for baseCID that will be saved at path,
+// replacing any journal already there.
+func NewJournal(path string, baseCID string) *Journal {
+	return &Journal{path: path, BaseCID: baseCID, Chunks: make(map[int]ManifestChunk)}
+}
+
+// OpenJournal loads the journal at path and compacts its file,
+// returning an empty journal if it does not exist.
+// A last record cut short by an interrupted write is ignored.
+func OpenJournal(path string, baseCID string) (*Journal, error) {
+	journal := NewJournal(path, baseCID)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return journal, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read upload journal: %v", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	for first := true; ; first = false {
+		var record journalRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid upload journal %q: %v", path, err)
+		}
+		if first && record.BaseCID != baseCID {
+			return nil, fmt.Errorf("upload journal %q belongs to %s", path, record.BaseCID)
+		}
+		if record.SealedDataKey != nil {
+			journal.SealedDataKey = record.SealedDataKey
+		}
+		if record.Chunk != nil {
+			journal.Chunks[record.Index] = *record.Chunk
+		}
+	}
+
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if err := journal.save(); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// EntryJournal returns the journal of the file at path in a stored directory,
+// kept next to journal. With resume, the file's recorded chunks are loaded.
+func (journal *Journal) EntryJournal(path string, resume bool) (*Journal, error) {
+	sum := sha256.Sum256([]byte(path))
+	entryPath := strings.TrimSuffix(journal.path, ".jsonl") + "-" + hex.EncodeToString(sum[:8]) + ".jsonl"
+
+	entry := NewJournal(entryPath, journal.BaseCID)
+	if resume {
+		var err error
+		entry, err = OpenJournal(entryPath, journal.BaseCID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	journal.mu.Lock()
+	journal.entries = append(journal.entries, entry)
+	journal.mu.Unlock()
+	return entry, nil
+}
+
+// Chunk returns the recorded chunk at index, if any.
+func (journal *Journal) Chunk(index int) (ManifestChunk, bool) {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	chunk, ok := journal.Chunks[index]
+	return chunk, ok
+}
+
+// SetDataKey records the sealed data key in the journal file.
+func (journal *Journal) SetDataKey(sealedDataKey []byte) error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	journal.SealedDataKey = sealedDataKey
+	return journal.append(journalRecord{SealedDataKey: sealedDataKey})
+}
+
+// Record marks the chunk at index as uploaded, appending it to the journal file.
+func (journal *Journal) Record(index int, chunk ManifestChunk) error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	journal.Chunks[index] = chunk
+	return journal.append(journalRecord{Index: index, Chunk: &chunk})
+}
+
+// Remove deletes the journal file, and those of its entries, once the store has completed.
+func (journal *Journal) Remove() error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	for _, entry := range journal.entries {
+		if err := entry.Remove(); err != nil {
+			return err
+		}
+	}
+	err := os.Remove(journal.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// append adds record to the journal file, or writes the whole journal
+// if the file does not hold it yet. The caller holds journal.mu.
+func (journal *Journal) append(record journalRecord) error {
+	if !journal.created {
+		return journal.save()
+	}
+	if err := appendRecord(journal.path, record); err != nil {
+		return fmt.Errorf("could not write upload journal: %v", err)
+	}
+	return nil
+}
+
+// save writes the journal, one record per chunk, to a temporary file and renames it over
+// the journal file. The caller holds journal.mu.
+func (journal *Journal) save() error {
+	records := []interface{}{journalRecord{BaseCID: journal.BaseCID, SealedDataKey: journal.SealedDataKey}}
+	for _, index := range sortedIndexes(journal.Chunks) {
+		chunk := journal.Chunks[index]
+		records = append(records, journalRecord{Index: index, Chunk: &chunk})
+	}
+	if err := os.MkdirAll(filepath.Dir(journal.path), 0700); err != nil {
+		return fmt.Errorf("could not create upload journal directory: %v", err)
+	}
+	if err := writeRecords(journal.path, records); err != nil {
+		return fmt.Errorf("could not write upload journal: %v", err)
+	}
+	journal.created = true
+	return nil
+}
+
+// sortedIndexes returns the indexes of chunks in increasing order.
+func sortedIndexes(chunks map[int]ManifestChunk) []int {
+	indexes := make([]int, 0, len(chunks))
+	for index := range chunks {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// writeRecords writes records as JSON lines to a temporary file and renames it over path.
+func writeRecords(path string, records []interface{}) error {
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	tempPath := path + ".tmp"
+	if err := ioutil.WriteFile(tempPath, data.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// appendRecord appends record to path as a JSON line, in a single write.
+func appendRecord(path string, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := JournalPath(dir, testBaseCID, "settings")
+
+	journal := NewJournal(path, testBaseCID)
+	if err := journal.SetDataKey([]byte("sealed key")); err != nil {
+		t.Fatal(err)
+	}
+	chunks := map[int]ManifestChunk{}
+	for index := 0; index < 3; index++ {
+		chunk := ManifestChunk{CID: testBaseCID, Offset: int64(index) * testChunkSize, Size: testChunkSize}
+		chunks[index] = chunk
+		if err := journal.Record(index, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A chunk recorded again replaces the earlier record.
+	chunks[1] = ManifestChunk{CID: "other", Offset: testChunkSize, Size: testChunkSize}
+	if err := journal.Record(1, chunks[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each record is appended, and a record cut short by an interrupted write is ignored.
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 5 {
+		t.Fatalf("journal file has %d lines, expected 5", lines)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"index":3,"chunk":{"cid":`)
+	file.Close()
+
+	opened, err := OpenJournal(path, testBaseCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(opened.SealedDataKey) != "sealed key" || !reflect.DeepEqual(opened.Chunks, chunks) {
+		t.Fatalf("opened key %q and chunks %v, expected %v", opened.SealedDataKey, opened.Chunks, chunks)
+	}
+	// Opening compacts the file to one record per chunk.
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 4 {
+		t.Errorf("compacted journal file has %d lines, expected 4", lines)
+	}
+
+	if _, err := OpenJournal(path, "QmOther"); err == nil {
+		t.Errorf("opened the journal of %s for another CID", testBaseCID)
+	}
+}
+
+// faultyStore fails every Put after the first puts and every chunk Get after the first gets,
+// and counts the calls to both; a limit of zero never fails.
+type faultyStore struct {
+	ObjectStore
+
+	mu         sync.Mutex
+	puts, gets int
+	putLimit   int
+	getLimit   int
+}
+
+// Put stores data unless the limit of puts is reached.
+func (store *faultyStore) Put(ctx context.Context, path string, data io.Reader) error {
+	store.mu.Lock()
+	store.puts++
+	failed := store.putLimit > 0 && store.puts > store.putLimit
+	store.mu.Unlock()
+	if failed {
+		return errFaulty
+	}
+	return store.ObjectStore.Put(ctx, path, data)
+}
+
+// Get returns the object at path unless it is a chunk and the limit of gets is reached.
+func (store *faultyStore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	if strings.HasSuffix(path, ".txt") {
+		return store.ObjectStore.Get(ctx, path)
+	}
+	store.mu.Lock()
+	store.gets++
+	failed := store.getLimit > 0 && store.gets > store.getLimit
+	store.mu.Unlock()
+	if failed {
+		return nil, errFaulty
+	}
+	return store.ObjectStore.Get(ctx, path)
+}
+
+// reset clears the counts and sets new limits.
+func (store *faultyStore) reset(putLimit int, getLimit int) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.puts, store.gets = 0, 0
+	store.putLimit, store.getLimit = putLimit, getLimit
+}
+
+func TestResumeStore(t *testing.T) {
+	stores, cleanup := testStores(t)
+	defer cleanup()
+	for name, backend := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := &faultyStore{ObjectStore: backend, putLimit: 4}
+			dataKey, err := NewDataKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := testData(2, testFileSize)
+			journalDir, cleanup := tempDir(t)
+			defer cleanup()
+			journalPath := JournalPath(journalDir, testBaseCID, "settings")
+			options := UploadOptions{
+				Prefix:      testUploadPath + testBaseCID + "/",
+				Algorithm:   AlgorithmAESGCM,
+				DataKey:     dataKey,
+				Concurrency: 1,
+				ChunkCID:    testChunkCID,
+				Journal:     NewJournal(journalPath, testBaseCID),
+				Retry:       RetryPolicy{Attempts: 1},
+			}
+
+			// The store is interrupted after four chunks.
+			if _, err := UploadChunks(ctx, store, bytes.NewReader(data), testBoundaries(data), options); !errors.Is(err, errFaulty) {
+				t.Fatalf("interrupted store: %v, expected %v", err, errFaulty)
+			}
+
+			journal, err := OpenJournal(journalPath, testBaseCID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(journal.Chunks) != 4 {
+				t.Fatalf("journal records %d chunks, expected 4", len(journal.Chunks))
+			}
+			// A recorded chunk that has gone from the store is uploaded again.
+			if err := backend.Delete(ctx, options.Prefix+journal.Chunks[1].CID); err != nil {
+				t.Fatal(err)
+			}
+
+			store.reset(0, 0)
+			options.Journal, options.Resume = journal, true
+			manifest := storeFile(t, store, data, dataKey, options)
+			// Chunks 1 and 4 to 10, and the meta file.
+			if store.puts != 9 {
+				t.Errorf("resumed store made %d puts, expected 9", store.puts)
+			}
+
+			dir, cleanup := tempDir(t)
+			defer cleanup()
+			if err := DownloadData(ctx, store, dir, testUploadPath, testBaseCID, testFileName, dataKey, 2, RetryPolicy{}); err != nil {
+				t.Fatal(err)
+			}
+			checkDownload(t, dir, data, manifest)
+		})
+	}
+}
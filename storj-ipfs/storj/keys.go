@@ -0,0 +1,72 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// DataKeySize is the size in bytes of a per-file data key and of the chunk keys derived from it.
+const DataKeySize = 32
+
+// chunkKeyInfo is the HKDF info prefix for chunk keys; the chunk index is appended to it.
+const chunkKeyInfo = "storj-ipfs chunk key"
+
+// legacyChunkKey is the fixed key every chunk was encrypted with before per-file data keys.
+// It is only used to read back uploads that carry no data key.
+var legacyChunkKey = []byte("This is a storj ipfs private key")
+
+// NewDataKey returns a random data key for a single stored file.
+func NewDataKey() ([]byte, error) {
+	dataKey := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("could not generate data key: %v", err)
+	}
+	return dataKey, nil
+}
+
+// ChunkKey derives the key of the chunk at index from the file's data key with HKDF-SHA256.
+// A nil data key returns the legacy fixed chunk key.
+func ChunkKey(dataKey []byte, index int) ([]byte, error) {
+	if dataKey == nil {
+		return legacyChunkKey, nil
+	}
+	if len(dataKey) != DataKeySize {
+		return nil, fmt.Errorf("invalid data key size %d", len(dataKey))
+	}
+
+	info := make([]byte, len(chunkKeyInfo)+8)
+	copy(info, chunkKeyInfo)
+	binary.BigEndian.PutUint64(info[len(chunkKeyInfo):], uint64(index))
+
+	chunkKey := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, dataKey, nil, info), chunkKey); err != nil {
+		return nil, fmt.Errorf("could not derive key for chunk %d: %v", index, err)
+	}
+	return chunkKey, nil
+}
+
+// fileKeyInfo is the HKDF info prefix for the data keys of files in a stored directory;
+// the file's path in the directory is appended to it.
+const fileKeyInfo = "storj-ipfs file key"
+
+// FileKey derives the data key of the file at path in a stored directory
+// from the directory's data key with HKDF-SHA256, so chunk keys are never shared between files.
+func FileKey(dataKey []byte, path string) ([]byte, error) {
+	if len(dataKey) != DataKeySize {
+		return nil, fmt.Errorf("invalid data key size %d", len(dataKey))
+	}
+
+	fileKey := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, dataKey, nil, []byte(fileKeyInfo+path)), fileKey); err != nil {
+		return nil, fmt.Errorf("could not derive key for file %q: %v", path, err)
+	}
+	return fileKey, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func TestChunkKey(t *testing.T) {
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dataKey) != DataKeySize || bytes.Equal(dataKey, otherKey) {
+		t.Fatalf("data keys %x and %x, expected two different keys of %d bytes", dataKey, otherKey, DataKeySize)
+	}
+
+	// Every key derived from either data key is different, and so is each data key.
+	seen := map[string]string{hex.EncodeToString(dataKey): "data key", hex.EncodeToString(otherKey): "other data key"}
+	add := func(name string, key []byte) {
+		if len(key) != DataKeySize {
+			t.Fatalf("%s has %d bytes, expected %d", name, len(key), DataKeySize)
+		}
+		if previous, ok := seen[hex.EncodeToString(key)]; ok {
+			t.Fatalf("%s is the same as %s", name, previous)
+		}
+		seen[hex.EncodeToString(key)] = name
+	}
+	for name, key := range map[string][]byte{"data key": dataKey, "other data key": otherKey} {
+		for index := 0; index < 4; index++ {
+			chunkKey, err := ChunkKey(key, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			add(fmt.Sprintf("%s chunk %d", name, index), chunkKey)
+
+			again, err := ChunkKey(key, index)
+			if err != nil || !bytes.Equal(again, chunkKey) {
+				t.Fatalf("%s chunk %d derived again as %x: %v", name, index, again, err)
+			}
+		}
+		for _, path := range []string{"a.txt", "dir/a.txt"} {
+			fileKey, err := FileKey(key, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			add(name+" file "+path, fileKey)
+		}
+	}
+
+	if _, err := ChunkKey(dataKey[:16], 0); err == nil {
+		t.Error("derived a chunk key from a short data key")
+	}
+	if _, err := FileKey(nil, "a.txt"); err == nil {
+		t.Error("derived a file key without a data key")
+	}
+}
+
+func TestChunkKeyLegacy(t *testing.T) {
+	// Uploads without a data key were encrypted with the fixed key, whatever the chunk.
+	for _, index := range []int{0, 1, 100} {
+		key, err := ChunkKey(nil, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, []byte("This is a storj ipfs private key")) {
+			t.Errorf("chunk %d: key %q, expected the legacy key", index, key)
+		}
+	}
+}
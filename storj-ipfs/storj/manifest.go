@@ -0,0 +1,169 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ManifestVersion is the manifest schema version written by store.
+// Version 0 is the legacy comma-separated list of chunk CIDs,
+// version 2 adds stored directories and version 3 shared chunks.
+const ManifestVersion = 3
+
+// Manifest describes a stored file and the encrypted chunks it was split into.
+// For a stored directory, Directory is set, Entries lists every file and
+// directory below it and FileSize is the total size of its files.
+// A stored pinset is a directory of CAR files, one per pin listed in Pins.
+// Archive is set when the stored file is an archive of the DAG rooted at the base CID.
+type Manifest struct {
+	Version   int             `json:"version"`
+	FileName  string          `json:"fileName"`
+	FileSize  int64           `json:"fileSize"`
+	Mode      uint32          `json:"mode"`
+	ModTime   time.Time       `json:"modTime"`
+	Chunks    []ManifestChunk `json:"chunks"`
+	Directory bool            `json:"directory,omitempty"`
+	Entries   []ManifestEntry `json:"entries,omitempty"`
+	Pins      []ManifestPin   `json:"pins,omitempty"`
+	Archive   string          `json:"archive,omitempty"`
+	// Chunker is the go-ipfs-chunker setting the files were split with, such as "size-262144".
+	Chunker string `json:"chunker,omitempty"`
+}
+
+// ArchiveCAR is the Archive of a file that is a CAR archive of a DAG.
+const ArchiveCAR = "car"
+
+// ManifestEntry describes a file or directory in a stored directory.
+// Path is slash separated and relative to the stored directory.
+// The chunks of a file are encrypted with keys derived from FileKey.
+type ManifestEntry struct {
+	Path    string          `json:"path"`
+	Dir     bool            `json:"dir,omitempty"`
+	Mode    uint32          `json:"mode"`
+	ModTime time.Time       `json:"modTime"`
+	Size    int64           `json:"size"`
+	Digest  string          `json:"digest,omitempty"`
+	Chunks  []ManifestChunk `json:"chunks,omitempty"`
+}
+
+// ManifestChunk describes one encrypted chunk of a stored file.
+// Legacy manifests only carry the CID.
+type ManifestChunk struct {
+	// CID names the chunk object below the stored CID's prefix: the CID of the envelope.
+	// A shared chunk, with Object set, is named by its Dedup id instead,
+	// the hex encoded keyed hash of its plaintext, which is not a CID.
+	CID           string `json:"cid"`
+	Offset        int64  `json:"offset"`
+	Size          int64  `json:"size"`
+	EncryptedSize int64  `json:"encryptedSize"`
+	Digest        string `json:"digest"`
+	// Object is the full object path of a shared chunk stored by Dedup, ending in its id.
+	Object string `json:"object,omitempty"`
+	// SharedKey is the base64 encoded key of a shared chunk, sealed with the chunk key.
+	SharedKey string `json:"sharedKey,omitempty"`
+}
+
+// ManifestPin records a DAG pinned on the backed up node.
+// Path is the entry holding the DAG exported as a CAR archive.
+type ManifestPin struct {
+	CID  string `json:"cid"`
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+// ChunkDigest returns the digest recorded for plaintext chunk data: hex encoded SHA-256.
+func ChunkDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify checks data against the size and digest recorded for the chunk.
+// Chunks from legacy manifests have nothing recorded and always pass.
+func (chunk ManifestChunk) Verify(data []byte) error {
+	sum := sha256.Sum256(data)
+	return chunk.verifySum(int64(len(data)), sum[:])
+}
+
+// verifySum checks the size and the SHA-256 sum of data hashed as it was read against the chunk.
+func (chunk ManifestChunk) verifySum(size int64, sum []byte) error {
+	if chunk.Digest == "" {
+		return nil
+	}
+	if size != chunk.Size || hex.EncodeToString(sum) != chunk.Digest {
+		return fmt.Errorf("chunk %s does not match manifest digest", chunk.CID)
+	}
+	return nil
+}
+
+// Marshal encodes the manifest as JSON.
+func (manifest *Manifest) Marshal() ([]byte, error) {
+	return json.Marshal(manifest)
+}
+
+// ParseManifest decodes a manifest, accepting both the JSON format
+// and the legacy "cid1,cid2,...," chunk list.
+func ParseManifest(data []byte) (*Manifest, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var manifest Manifest
+		if err := json.Unmarshal(trimmed, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %v", err)
+		}
+		if manifest.Version < 1 || manifest.Version > ManifestVersion {
+			return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+		}
+		if err := manifest.checkSizes(); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %v", err)
+		}
+		return &manifest, nil
+	}
+
+	manifest := &Manifest{Version: 0}
+	list := strings.TrimSuffix(string(trimmed), ",")
+	if list == "" {
+		return manifest, nil
+	}
+	for _, chunkCID := range strings.Split(list, ",") {
+		manifest.Chunks = append(manifest.Chunks, ManifestChunk{CID: chunkCID})
+	}
+	return manifest, nil
+}
+
+// checkSizes checks that no size or offset in the manifest is negative
+// and that no chunk ends past the largest offset.
+func (manifest *Manifest) checkSizes() error {
+	if manifest.FileSize < 0 {
+		return fmt.Errorf("file size %d", manifest.FileSize)
+	}
+	if err := checkChunks(manifest.Chunks); err != nil {
+		return err
+	}
+	for _, entry := range manifest.Entries {
+		if entry.Size < 0 {
+			return fmt.Errorf("entry %q size %d", entry.Path, entry.Size)
+		}
+		if err := checkChunks(entry.Chunks); err != nil {
+			return fmt.Errorf("entry %q: %v", entry.Path, err)
+		}
+	}
+	return nil
+}
+
+// checkChunks checks the sizes and offsets of chunks.
+func checkChunks(chunks []ManifestChunk) error {
+	for index, chunk := range chunks {
+		if chunk.Offset < 0 || chunk.Size < 0 || chunk.EncryptedSize < 0 || chunk.Offset > math.MaxInt64-chunk.Size {
+			return fmt.Errorf("chunk %d of %d bytes at %d, %d encrypted", index, chunk.Size, chunk.Offset, chunk.EncryptedSize)
+		}
+	}
+	return nil
+}
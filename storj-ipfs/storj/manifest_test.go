@@ -0,0 +1,129 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	errs "storj-ipfs/errs"
+)
+
+// testCIDv1 is a CIDv1 in the default base32 encoding.
+const testCIDv1 = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+
+func TestParseManifest(t *testing.T) {
+	manifest := &Manifest{
+		Version:  ManifestVersion,
+		FileName: testFileName,
+		FileSize: 3,
+		Mode:     0640,
+		ModTime:  time.Date(2019, 10, 4, 12, 30, 0, 0, time.UTC),
+		Chunks:   []ManifestChunk{{CID: testCIDv1, Size: 3, EncryptedSize: 40, Digest: ChunkDigest([]byte("abc"))}},
+		Chunker:  "size-262144",
+	}
+	data, err := manifest.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, manifest) {
+		t.Errorf("parsed %+v, expected %+v", parsed, manifest)
+	}
+
+	for _, test := range []struct {
+		data   string
+		chunks []string
+	}{
+		{data: testBaseCID + "," + testBaseCID + ",", chunks: []string{testBaseCID, testBaseCID}},
+		{data: testBaseCID + "," + testCIDv1 + ",\n", chunks: []string{testBaseCID, testCIDv1}},
+		{data: testBaseCID, chunks: []string{testBaseCID}},
+		{data: "", chunks: nil},
+	} {
+		parsed, err := ParseManifest([]byte(test.data))
+		if err != nil {
+			t.Fatalf("legacy manifest %q: %v", test.data, err)
+		}
+		var chunks []string
+		for _, chunk := range parsed.Chunks {
+			chunks = append(chunks, chunk.CID)
+		}
+		if parsed.Version != 0 || !reflect.DeepEqual(chunks, test.chunks) {
+			t.Errorf("legacy manifest %q parsed as version %d with chunks %q", test.data, parsed.Version, chunks)
+		}
+	}
+
+	for _, data := range []string{
+		`{"version":0}`, `{"version":99}`, `{"version":1`, `{"chunks":"Qm"}`,
+		`{"version":1,"fileSize":-1}`,
+		`{"version":1,"chunks":[{"cid":"Qm","size":-1}]}`,
+		`{"version":1,"chunks":[{"cid":"Qm","offset":-1}]}`,
+		`{"version":1,"chunks":[{"cid":"Qm","encryptedSize":-1}]}`,
+		`{"version":1,"chunks":[{"cid":"Qm","offset":9223372036854775807,"size":1}]}`,
+		`{"version":2,"directory":true,"entries":[{"path":"a","size":-1}]}`,
+		`{"version":2,"directory":true,"entries":[{"path":"a","chunks":[{"cid":"Qm","encryptedSize":-5}]}]}`,
+	} {
+		if _, err := ParseManifest([]byte(data)); err == nil {
+			t.Errorf("parsed manifest %s", data)
+		}
+	}
+}
+
+func TestManifestChunkVerify(t *testing.T) {
+	chunk := ManifestChunk{CID: testBaseCID, Size: 3, Digest: ChunkDigest([]byte("abc"))}
+	if err := chunk.Verify([]byte("abc")); err != nil {
+		t.Error(err)
+	}
+	for _, data := range []string{"abd", "abcd", ""} {
+		if err := chunk.Verify([]byte(data)); err == nil {
+			t.Errorf("verified %q", data)
+		}
+	}
+	// Chunks of legacy manifests have no digest.
+	if err := (ManifestChunk{CID: testBaseCID}).Verify([]byte("anything")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParsePointerConfig(t *testing.T) {
+	dataKey := bytes.Repeat([]byte{5}, DataKeySize)
+	config := &PointerConfig{Version: PointerConfigVersion, Bucket: "bucket", UploadPath: "uploads/", FileName: testFileName, DataKey: dataKey}
+	data, err := config.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed, err := ParsePointerConfig(data); err != nil || !reflect.DeepEqual(parsed, config) {
+		t.Errorf("parsed %+v, expected %+v: %v", parsed, config, err)
+	}
+
+	legacy := map[string]*PointerConfig{
+		"bucket,uploads/," + testFileName: {Bucket: "bucket", UploadPath: "uploads/", FileName: testFileName},
+		"bucket,uploads/," + testFileName + "," + base64.StdEncoding.EncodeToString(dataKey): {Bucket: "bucket", UploadPath: "uploads/", FileName: testFileName, DataKey: dataKey},
+	}
+	for data, expected := range legacy {
+		if parsed, err := ParsePointerConfig([]byte(data)); err != nil || !reflect.DeepEqual(parsed, expected) {
+			t.Errorf("legacy config %q parsed as %+v, expected %+v: %v", data, parsed, expected, err)
+		}
+	}
+
+	for _, data := range []string{
+		"bucket,uploads/",
+		"bucket,uploads/," + testFileName + ",not a key",
+		"bucket,uploads/," + testFileName + "," + base64.StdEncoding.EncodeToString(dataKey[:16]),
+		`{"version":2,"bucket":"bucket"}`,
+		`{"version":1,"dataKey":"AAAA"}`,
+		`{"version":1,`,
+	} {
+		if _, err := ParsePointerConfig([]byte(data)); !errors.Is(err, errs.ErrInvalidHash) {
+			t.Errorf("config %q: %v, expected %v", data, err, errs.ErrInvalidHash)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemStore is an ObjectStore that keeps every object in memory.
+// It is intended for tests and dry runs that must not touch the network.
+type MemStore struct {
+	mu      sync.Mutex
+	objects map[string]memObject
+}
+
+type memObject struct {
+	data     []byte
+	modified time.Time
+}
+
+// NewMemStore returns an empty in-memory ObjectStore.
+func NewMemStore() *MemStore {
+	return &MemStore{objects: make(map[string]memObject)}
+}
+
+// Put reads data fully and stores it under path.
+func (store *MemStore) Put(ctx context.Context, path string, data io.Reader) error {
+	contents, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.objects[path] = memObject{data: contents, modified: time.Now()}
+	return nil
+}
+
+// Get returns the whole object stored under path.
+func (store *MemStore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	return store.GetRange(ctx, path, 0, -1)
+}
+
+// GetRange returns part of the object stored under path.
+func (store *MemStore) GetRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	store.mu.Lock()
+	object, ok := store.objects[path]
+	store.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", path, ErrObjectNotFound)
+	}
+
+	size := int64(len(object.data))
+	if offset < 0 || offset > size {
+		return nil, fmt.Errorf("offset %d out of range for %q", offset, path)
+	}
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+	return ioutil.NopCloser(bytes.NewReader(object.data[offset:end])), nil
+}
+
+// Stat returns the size and modification time of the object stored under path.
+func (store *MemStore) Stat(ctx context.Context, path string) (ObjectInfo, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	object, ok := store.objects[path]
+	if !ok {
+		return ObjectInfo{}, fmt.Errorf("%q: %w", path, ErrObjectNotFound)
+	}
+	return ObjectInfo{Path: path, Size: int64(len(object.data)), Modified: object.modified}, nil
+}
+
+// List returns every object whose path starts with prefix.
+func (store *MemStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var infos []ObjectInfo
+	for path, object := range store.objects {
+		if strings.HasPrefix(path, prefix) {
+			infos = append(infos, ObjectInfo{Path: path, Size: int64(len(object.data)), Modified: object.modified})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+	return infos, nil
+}
+
+// Delete removes the object stored under path.
+func (store *MemStore) Delete(ctx context.Context, path string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.objects[path]; !ok {
+		return fmt.Errorf("%q: %w", path, ErrObjectNotFound)
+	}
+	delete(store.objects, path)
+	return nil
+}
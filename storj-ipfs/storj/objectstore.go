@@ -0,0 +1,158 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	errs "storj-ipfs/errs"
+
+	"storj.io/storj/lib/uplink"
+	libstorj "storj.io/storj/pkg/storj"
+)
+
+// ErrObjectNotFound is returned by an ObjectStore when the requested path does not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes a single object held by an ObjectStore.
+type ObjectInfo struct {
+	Path     string
+	Size     int64
+	Modified time.Time
+}
+
+// ObjectStore is the set of object operations the connector needs from Storj.
+// Paths are full object paths within the store, including any upload prefix.
+type ObjectStore interface {
+	// Put stores everything read from data under path, replacing any existing object.
+	Put(ctx context.Context, path string, data io.Reader) error
+	// Get returns a reader over the whole object stored under path.
+	Get(ctx context.Context, path string) (io.ReadCloser, error)
+	// GetRange returns a reader over length bytes starting at offset.
+	// A negative length reads to the end of the object.
+	GetRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
+	// Stat returns information about the object stored under path.
+	Stat(ctx context.Context, path string) (ObjectInfo, error)
+	// List returns every object whose path starts with prefix, sorted by path.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Delete removes the object stored under path.
+	Delete(ctx context.Context, path string) error
+}
+
+// uplinkStore is an ObjectStore backed by an open libuplink bucket.
+type uplinkStore struct {
+	bucket *uplink.Bucket
+}
+
+// NewUplinkStore returns an ObjectStore that reads and writes objects in bucket.
+func NewUplinkStore(bucket *uplink.Bucket) ObjectStore {
+	return &uplinkStore{bucket: bucket}
+}
+
+// Put uploads data to the bucket under path.
+func (store *uplinkStore) Put(ctx context.Context, path string, data io.Reader) error {
+	return store.bucket.UploadObject(ctx, path, data, nil)
+}
+
+// Get downloads the whole object stored under path.
+func (store *uplinkStore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	return store.GetRange(ctx, path, 0, -1)
+}
+
+// GetRange downloads part of the object stored under path.
+func (store *uplinkStore) GetRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	object, err := store.openObject(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := object.DownloadRange(ctx, offset, length)
+	if err != nil {
+		object.Close()
+		return nil, fmt.Errorf("could not initiate download of %q: %w", path, err)
+	}
+	return &objectReader{ReadCloser: stream, object: object}, nil
+}
+
+// Stat returns the size and modification time of the object stored under path.
+func (store *uplinkStore) Stat(ctx context.Context, path string) (ObjectInfo, error) {
+	object, err := store.openObject(ctx, path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer object.Close()
+
+	return ObjectInfo{Path: path, Size: object.Meta.Size, Modified: object.Meta.Modified}, nil
+}
+
+// List walks the bucket recursively and returns the objects under prefix.
+func (store *uplinkStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	// libuplink only lists below whole path components and returns
+	// paths relative to them, so list the enclosing "directory" and filter.
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+
+	var infos []ObjectInfo
+	options := libstorj.ListOptions{Prefix: dir, Direction: libstorj.After, Recursive: true}
+	for {
+		list, err := store.bucket.ListObjects(ctx, &options)
+		if err != nil {
+			return nil, fmt.Errorf("could not list objects under %q: %w", dir, err)
+		}
+		for _, item := range list.Items {
+			if item.IsPrefix || !strings.HasPrefix(dir+item.Path, prefix) {
+				continue
+			}
+			infos = append(infos, ObjectInfo{Path: dir + item.Path, Size: item.Size, Modified: item.Modified})
+		}
+		if !list.More || len(list.Items) == 0 {
+			break
+		}
+		options.Cursor = list.Items[len(list.Items)-1].Path
+	}
+	return infos, nil
+}
+
+// Delete removes the object stored under path from the bucket.
+func (store *uplinkStore) Delete(ctx context.Context, path string) error {
+	err := store.bucket.DeleteObject(ctx, path)
+	if libstorj.ErrObjectNotFound.Has(err) {
+		return fmt.Errorf("%q: %w", path, ErrObjectNotFound)
+	}
+	return err
+}
+
+// openObject opens path, translating libuplink's not found error.
+func (store *uplinkStore) openObject(ctx context.Context, path string) (*uplink.Object, error) {
+	object, err := store.bucket.OpenObject(ctx, path)
+	if libstorj.ErrObjectNotFound.Has(err) {
+		return nil, fmt.Errorf("%q: %w", path, ErrObjectNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open object at %q: %w", path, err)
+	}
+	if object == nil {
+		return nil, errs.New(errs.ErrAccessDenied, fmt.Sprintf("could not read object %q: Access Denied", path))
+	}
+	return object, nil
+}
+
+// objectReader closes the download stream together with the object it came from.
+type objectReader struct {
+	io.ReadCloser
+	object *uplink.Object
+}
+
+// Close closes the stream and then the object.
+func (reader *objectReader) Close() error {
+	err := reader.ReadCloser.Close()
+	if closeErr := reader.object.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
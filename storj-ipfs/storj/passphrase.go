@@ -0,0 +1,105 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// kdfMagic starts data sealed with a passphrase-derived key.
+const kdfMagic = "SIPK"
+
+// kdfArgon2id identifies Argon2id in the KDF header.
+const kdfArgon2id = 1
+
+// kdfSaltSize is the size of the random salt stored in the KDF header.
+const kdfSaltSize = 16
+
+// kdfHeaderSize is the size of the KDF header:
+// magic | kdf | time | memory (KiB) | threads | salt.
+const kdfHeaderSize = len(kdfMagic) + 1 + 4 + 4 + 1 + kdfSaltSize
+
+// Bounds of the cost parameters accepted from a header, so a crafted header cannot make
+// opening run out of memory or stall: at most maxKDFTime passes over maxKDFMemory KiB (1 GiB)
+// with maxKDFThreads lanes.
+const (
+	maxKDFTime    = 16
+	maxKDFMemory  = 1024 * 1024
+	maxKDFThreads = 64
+)
+
+// KDFParams are the Argon2id cost parameters used to derive a key from a passphrase.
+type KDFParams struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// DefaultKDFParams are the parameters used for new data: 3 passes over 64 MiB with 4 lanes.
+var DefaultKDFParams = KDFParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// SealWithPassphrase derives a key from passphrase with Argon2id and a random salt,
+// and seals plaintext with it. The salt and parameters are stored in a header
+// in front of the envelope so the key can be derived again when opening.
+func SealWithPassphrase(algorithm Algorithm, passphrase string, plaintext []byte) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("secret key must not be empty")
+	}
+
+	params := DefaultKDFParams
+	header := make([]byte, kdfHeaderSize)
+	copy(header, kdfMagic)
+	offset := len(kdfMagic)
+	header[offset] = kdfArgon2id
+	binary.BigEndian.PutUint32(header[offset+1:], params.Time)
+	binary.BigEndian.PutUint32(header[offset+5:], params.Memory)
+	header[offset+9] = params.Threads
+	salt := header[offset+10:]
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	envelope, err := Seal(algorithm, deriveKey(passphrase, salt, params), 0, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, envelope...), nil
+}
+
+// OpenWithPassphrase opens data sealed by SealWithPassphrase.
+// Data without a KDF header was sealed with the passphrase used directly as the key,
+// either in an envelope or, by the first releases, with the legacy scheme.
+func OpenWithPassphrase(passphrase string, sealed []byte) ([]byte, error) {
+	if len(sealed) < kdfHeaderSize || !bytes.Equal(sealed[:len(kdfMagic)], []byte(kdfMagic)) {
+		return openLegacy([]byte(passphrase), 0, sealed)
+	}
+
+	offset := len(kdfMagic)
+	if sealed[offset] != kdfArgon2id {
+		return nil, fmt.Errorf("unsupported key derivation function %d", sealed[offset])
+	}
+	params := KDFParams{
+		Time:    binary.BigEndian.Uint32(sealed[offset+1:]),
+		Memory:  binary.BigEndian.Uint32(sealed[offset+5:]),
+		Threads: sealed[offset+9],
+	}
+	if params.Time == 0 || params.Time > maxKDFTime || params.Threads == 0 || params.Threads > maxKDFThreads || params.Memory > maxKDFMemory {
+		return nil, errors.New("invalid key derivation parameters")
+	}
+	salt := sealed[offset+10 : kdfHeaderSize]
+
+	return Open(deriveKey(passphrase, salt, params), 0, sealed[kdfHeaderSize:])
+}
+
+// deriveKey stretches passphrase into a 32 byte key with Argon2id.
+func deriveKey(passphrase string, salt []byte, params KDFParams) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, params.Time, params.Memory, params.Threads, DataKeySize)
+}
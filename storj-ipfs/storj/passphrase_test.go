@@ -0,0 +1,38 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestOpenWithPassphrase(t *testing.T) {
+	sealed, err := SealWithPassphrase(AlgorithmXChaCha20Poly1305, "correct horse battery staple", []byte("config data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := OpenWithPassphrase("correct horse battery staple", sealed); err != nil || string(plaintext) != "config data" {
+		t.Fatalf("opened %q: %v", plaintext, err)
+	}
+	if _, err := OpenWithPassphrase("wrong passphrase", sealed); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("opened with a wrong passphrase: %v", err)
+	}
+
+	// Headers asking for more work than the bounds are rejected before deriving a key.
+	offset := len(kdfMagic)
+	for name, tamper := range map[string]func(header []byte){
+		"time":    func(header []byte) { binary.BigEndian.PutUint32(header[offset+1:], 0xFFFFFFFF) },
+		"memory":  func(header []byte) { binary.BigEndian.PutUint32(header[offset+5:], 0xFFFFFFFF) },
+		"threads": func(header []byte) { header[offset+9] = 0xFF },
+		"no time": func(header []byte) { binary.BigEndian.PutUint32(header[offset+1:], 0) },
+	} {
+		crafted := append([]byte(nil), sealed...)
+		tamper(crafted)
+		if _, err := OpenWithPassphrase("correct horse battery staple", crafted); err == nil || errors.Is(err, ErrIntegrity) {
+			t.Errorf("%s: header accepted: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// PinsetListing returns a listing of pins with one "type cid" line per pin.
+// Its CID is the base CID of a stored pinset; as pins are content addressed,
+// it identifies the content of the whole pinset.
+func PinsetListing(pins []ManifestPin) []byte {
+	var listing bytes.Buffer
+	for _, pin := range pins {
+		fmt.Fprintf(&listing, "%s %s\n", pin.Type, pin.CID)
+	}
+	return listing.Bytes()
+}
+
+// UploadPinset exports every pin with export to a temporary file and uploads the CAR archive as a file
+// named after the pin's CID, split with the chunker setting,
+// returning the manifest entries of the archives.
+// The Path of every pin is set to the entry of its archive.
+func UploadPinset(ctx context.Context, store ObjectStore, pins []ManifestPin, export func(ctx context.Context, cid string) (io.ReadCloser, error), setting string, options UploadOptions) ([]ManifestEntry, error) {
+	entries := make([]ManifestEntry, 0, len(pins))
+	for i := range pins {
+		pin := &pins[i]
+		pin.Path = pin.CID + ".car"
+
+		archive, err := export(ctx, pin.CID)
+		if err != nil {
+			return nil, fmt.Errorf("could not export %s: %w", pin.CID, err)
+		}
+		// The archive is spooled: every chunk of it is read for its digest, then for its CID and once more to upload it.
+		source, cleanup, err := Spool(archive)
+		archive.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not export %s: %w", pin.CID, err)
+		}
+		entry := ManifestEntry{Path: pin.Path, Mode: 0644}
+		err = UploadEntry(ctx, store, &entry, source, setting, options)
+		cleanup()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
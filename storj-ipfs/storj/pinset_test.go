@@ -0,0 +1,78 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+
+	ipfs "storj-ipfs/ipfs"
+)
+
+func TestUploadPinset(t *testing.T) {
+	ctx := context.Background()
+	node := ipfs.NewFakeNode()
+	contents := map[string][]byte{}
+	for seed, size := range []int{testChunkSize / 2, 3*testChunkSize + 1} {
+		data := testData(int64(20+seed), size)
+		hash, err := node.Add(ctx, bytes.NewReader(data), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := node.Pin(ctx, hash); err != nil {
+			t.Fatal(err)
+		}
+		contents[hash] = data
+	}
+
+	pinned, err := ipfs.ListPins(ctx, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins := make([]ManifestPin, 0, len(pinned))
+	for _, dag := range pinned {
+		pins = append(pins, ManifestPin{CID: dag.CID, Type: dag.Type})
+	}
+
+	store := NewMemStore()
+	options := uploadOptions(t, 2)
+	entries, err := UploadPinset(ctx, store, pins, node.DagExport, "size-"+strconv.Itoa(testChunkSize), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(pins) {
+		t.Fatalf("%d entries for %d pins", len(entries), len(pins))
+	}
+	for i, entry := range entries {
+		pin := pins[i]
+		data := contents[pin.CID]
+		if pin.Path != pin.CID+".car" || entry.Path != pin.Path {
+			t.Errorf("pin %s recorded at %q with entry %q", pin.CID, pin.Path, entry.Path)
+		}
+		if entry.Size != int64(len(data)) || entry.Digest != ChunkDigest(data) {
+			t.Errorf("entry %s has %d bytes with digest %s, expected %d", entry.Path, entry.Size, entry.Digest, len(data))
+		}
+
+		// Every archive is sealed with the file key of its entry.
+		fileKey, err := FileKey(options.DataKey, entry.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		downloaded := &bytes.Buffer{}
+		if _, err := downloaded.ReadFrom(StreamChunks(ctx, store, entry.Chunks, options.Prefix, fileKey, RetryPolicy{})); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(downloaded.Bytes(), data) {
+			t.Errorf("entry %s differs from the exported DAG", entry.Path)
+		}
+	}
+
+	// A pin that cannot be exported fails the backup.
+	missing := []ManifestPin{{CID: testBaseCID, Type: ipfs.RecursivePin}}
+	if _, err := UploadPinset(ctx, store, missing, node.DagExport, "size-"+strconv.Itoa(testChunkSize), options); err == nil {
+		t.Error("backed up a pin that cannot be exported")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	errs "storj-ipfs/errs"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// pointerMagic starts every self-describing pointer blob.
+const pointerMagic = "SIPP"
+
+// PointerVersion is the layout of pointer blobs written by store:
+// magic | version | uvarint CID length | CID string | sealed config.
+const PointerVersion = 1
+
+// legacyCIDSize is the size of the CIDv0 prefix of legacy pointer blobs.
+const legacyCIDSize = 46
+
+// Pointer is the blob published on IPFS for a stored file. Its hash is the shareable hash.
+type Pointer struct {
+	// BaseCID is the CID of the original file, in any CID encoding.
+	BaseCID string
+	// SealedConfig is the PointerConfig sealed with the user's secret.
+	SealedConfig []byte
+}
+
+// Marshal encodes the pointer as a self-describing blob.
+func (pointer *Pointer) Marshal() []byte {
+	blob := make([]byte, 0, len(pointerMagic)+1+binary.MaxVarintLen64+len(pointer.BaseCID)+len(pointer.SealedConfig))
+	blob = append(blob, pointerMagic...)
+	blob = append(blob, PointerVersion)
+	var length [binary.MaxVarintLen64]byte
+	blob = append(blob, length[:binary.PutUvarint(length[:], uint64(len(pointer.BaseCID)))]...)
+	blob = append(blob, pointer.BaseCID...)
+	return append(blob, pointer.SealedConfig...)
+}
+
+// ParsePointer decodes a pointer blob, accepting both the self-describing layout
+// and the legacy layout of a 46 character CIDv0 followed by the sealed config.
+func ParsePointer(blob []byte) (*Pointer, error) {
+	var pointer Pointer
+	if bytes.HasPrefix(blob, []byte(pointerMagic)) {
+		rest := blob[len(pointerMagic):]
+		if len(rest) == 0 || rest[0] != PointerVersion {
+			return nil, errs.New(errs.ErrInvalidHash, "unsupported shareable hash data version")
+		}
+		length, n := binary.Uvarint(rest[1:])
+		if n <= 0 || length > uint64(len(rest)-1-n) {
+			return nil, errs.New(errs.ErrInvalidHash, "Invalid shareable hash data")
+		}
+		start := 1 + n
+		pointer.BaseCID = string(rest[start : start+int(length)])
+		pointer.SealedConfig = rest[start+int(length):]
+	} else {
+		if len(blob) < legacyCIDSize || !bytes.HasPrefix(blob, []byte("Qm")) {
+			return nil, errs.New(errs.ErrInvalidHash, "Invalid shareable hash data")
+		}
+		pointer.BaseCID = string(blob[:legacyCIDSize])
+		pointer.SealedConfig = blob[legacyCIDSize:]
+	}
+
+	if _, err := cid.Decode(pointer.BaseCID); err != nil {
+		return nil, errs.Wrap(errs.ErrInvalidHash, err, "Invalid base CID in shareable hash data")
+	}
+	return &pointer, nil
+}
+
+// PointerConfigVersion is the schema version of the Storj location data sealed in the pointer blob.
+const PointerConfigVersion = 1
+
+// PointerConfig is the Storj location of a stored file, sealed with the user's secret
+// and published on IPFS together with the base CID.
+type PointerConfig struct {
+	Version    int    `json:"version"`
+	Bucket     string `json:"bucket"`
+	UploadPath string `json:"uploadPath"`
+	FileName   string `json:"fileName"`
+	DataKey    []byte `json:"dataKey,omitempty"`
+}
+
+// Marshal encodes the pointer config as JSON.
+func (config *PointerConfig) Marshal() ([]byte, error) {
+	return json.Marshal(config)
+}
+
+// ParsePointerConfig decodes pointer config data, accepting both the JSON format
+// and the legacy "bucket,path,filename[,datakey]" list.
+func ParsePointerConfig(data []byte) (*PointerConfig, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var config PointerConfig
+		if err := json.Unmarshal(trimmed, &config); err != nil {
+			return nil, errs.Wrap(errs.ErrInvalidHash, err, "invalid configuration data")
+		}
+		if config.Version < 1 || config.Version > PointerConfigVersion {
+			return nil, errs.New(errs.ErrInvalidHash, fmt.Sprintf("unsupported configuration data version %d", config.Version))
+		}
+		if config.DataKey != nil && len(config.DataKey) != DataKeySize {
+			return nil, errs.New(errs.ErrInvalidHash, "Invalid data key in shareable hash")
+		}
+		return &config, nil
+	}
+
+	fields := strings.Split(string(trimmed), ",")
+	if len(fields) < 3 {
+		return nil, errs.New(errs.ErrInvalidHash, "Invalid configuration data in shareable hash")
+	}
+	config := &PointerConfig{Bucket: fields[0], UploadPath: fields[1], FileName: fields[2]}
+	// Uploads made before per-file keys carry no data key
+	// and are read back with the legacy chunk key.
+	if len(fields) > 3 {
+		dataKey, err := base64.StdEncoding.DecodeString(fields[3])
+		if err != nil || len(dataKey) != DataKeySize {
+			return nil, errs.New(errs.ErrInvalidHash, "Invalid data key in shareable hash")
+		}
+		config.DataKey = dataKey
+	}
+	return config, nil
+}
+
+// OpenPointer parses the pointer blob read from IPFS and opens its configuration data
+// with the key derived from the user's secret passphrase.
+func OpenPointer(blob []byte, passphrase string) (*Pointer, *PointerConfig, error) {
+	// Seperate the base CID and configration data
+	pointer, err := ParsePointer(blob)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Decrypt the configration data with the key derived from the user's secret.
+	decryptData, err := OpenWithPassphrase(passphrase, pointer.SealedConfig)
+	if err != nil {
+		return nil, nil, errs.Wrap(errs.ErrDecrypt, err, "Could not decrypt configuration data")
+	}
+
+	// Parse the configration data
+	pointerConfig, err := ParsePointerConfig(decryptData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pointer, pointerConfig, nil
+}
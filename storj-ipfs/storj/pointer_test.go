@@ -0,0 +1,78 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	errs "storj-ipfs/errs"
+)
+
+func TestParsePointer(t *testing.T) {
+	sealed := []byte("sealed config")
+	for _, baseCID := range []string{testBaseCID, testCIDv1} {
+		pointer := &Pointer{BaseCID: baseCID, SealedConfig: sealed}
+		parsed, err := ParsePointer(pointer.Marshal())
+		if err != nil {
+			t.Fatalf("%s: %v", baseCID, err)
+		}
+		if parsed.BaseCID != baseCID || !bytes.Equal(parsed.SealedConfig, sealed) {
+			t.Errorf("%s: parsed %q and %q", baseCID, parsed.BaseCID, parsed.SealedConfig)
+		}
+	}
+
+	// Legacy blobs are the 46 character CIDv0 followed by the sealed config.
+	legacy := append([]byte(testBaseCID), sealed...)
+	parsed, err := ParsePointer(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.BaseCID != testBaseCID || !bytes.Equal(parsed.SealedConfig, sealed) {
+		t.Errorf("legacy blob parsed as %q and %q", parsed.BaseCID, parsed.SealedConfig)
+	}
+
+	valid := (&Pointer{BaseCID: testCIDv1, SealedConfig: sealed}).Marshal()
+	versioned := append([]byte(nil), valid...)
+	versioned[len(pointerMagic)] = PointerVersion + 1
+	for name, blob := range map[string][]byte{
+		"empty":           nil,
+		"short legacy":    []byte(testBaseCID[:20]),
+		"legacy CIDv1":    append([]byte(testCIDv1), sealed...),
+		"legacy not CID":  append([]byte("Qm"+string(bytes.Repeat([]byte{'0'}, legacyCIDSize-2))), sealed...),
+		"magic only":      []byte(pointerMagic),
+		"unknown version": versioned,
+		"truncated CID":   valid[:len(pointerMagic)+10],
+		"invalid CID":     (&Pointer{BaseCID: "not a CID", SealedConfig: sealed}).Marshal(),
+	} {
+		if _, err := ParsePointer(blob); !errors.Is(err, errs.ErrInvalidHash) {
+			t.Errorf("%s: %v, expected %v", name, err, errs.ErrInvalidHash)
+		}
+	}
+}
+
+func TestOpenPointer(t *testing.T) {
+	config := &PointerConfig{Version: PointerConfigVersion, Bucket: "bucket", UploadPath: testUploadPath, FileName: testFileName}
+	data, err := config.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := SealWithPassphrase(AlgorithmAESGCM, "passphrase", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := (&Pointer{BaseCID: testCIDv1, SealedConfig: sealed}).Marshal()
+
+	pointer, opened, err := OpenPointer(blob, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pointer.BaseCID != testCIDv1 || opened.FileName != testFileName || opened.UploadPath != testUploadPath {
+		t.Errorf("opened %q with %+v", pointer.BaseCID, opened)
+	}
+	if _, _, err := OpenPointer(blob, "other passphrase"); !errors.Is(err, errs.ErrDecrypt) {
+		t.Errorf("opened with another passphrase: %v, expected %v", err, errs.ErrDecrypt)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	errs "storj-ipfs/errs"
+	logging "storj-ipfs/logging"
+	timeouts "storj-ipfs/timeouts"
+)
+
+// Defaults of a RetryPolicy.
+const (
+	DefaultRetryAttempts = 5
+	DefaultRetryDelay    = 500 * time.Millisecond
+	DefaultRetryMaxDelay = 30 * time.Second
+)
+
+// RetryPolicy retries an operation failing with a transient error,
+// waiting a jittered, exponentially growing delay between attempts.
+// Its zero value is the default policy.
+type RetryPolicy struct {
+	// Attempts is the most attempts made, including the first; zero means DefaultRetryAttempts.
+	Attempts int
+	// Delay is the longest wait before the second attempt, doubled for every further attempt;
+	// zero means DefaultRetryDelay.
+	Delay time.Duration
+	// MaxDelay is the longest wait between two attempts; zero means DefaultRetryMaxDelay.
+	MaxDelay time.Duration
+	// Deadline bounds the time of all attempts of an operation together; zero means no limit.
+	Deadline time.Duration
+}
+
+// ParseRetryPolicy returns the policy of the configured number of attempts and total deadline,
+// falling back to the defaults when they are empty.
+func ParseRetryPolicy(attempts string, deadline string) (RetryPolicy, error) {
+	var policy RetryPolicy
+	if attempts != "" {
+		var err error
+		policy.Attempts, err = strconv.Atoi(attempts)
+		if err != nil || policy.Attempts <= 0 {
+			return policy, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("Invalid retry attempts %q", attempts))
+		}
+	}
+	var err error
+	policy.Deadline, err = timeouts.Parse(deadline)
+	if err != nil {
+		return policy, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("Invalid retry deadline %q", deadline))
+	}
+	return policy, nil
+}
+
+// Do calls operation until it succeeds, fails with an error that is not Retryable,
+// runs out of attempts or reaches the deadline, and returns its last error.
+// When ctx is done, the error wraps ctx.Err(), so a cancelled operation is reported as such.
+// Credentials refused by Storj are reported as errs.ErrAccessDenied.
+func (policy RetryPolicy) Do(ctx context.Context, operation func(ctx context.Context) error) error {
+	attempts := policy.Attempts
+	if attempts <= 0 {
+		attempts = DefaultRetryAttempts
+	}
+	ctx, cancel := WithTimeout(ctx, policy.Deadline)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		err := operation(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return stopped(attempt, err, ctx.Err())
+		}
+		if isRefused(err) {
+			return errs.Wrap(errs.ErrAccessDenied, err, "Storj refused the request")
+		}
+		if !Retryable(err) {
+			return err
+		}
+		if attempt == attempts {
+			return fmt.Errorf("failed after %d attempts: %w", attempts, err)
+		}
+
+		delay := policy.delay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return fmt.Errorf("failed after %d attempts, retry deadline reached: %w", attempt, err)
+		}
+		logging.FromContext(ctx).Warn("Retrying", logging.Any("attempt", attempt), logging.Any("delay", delay.Round(time.Millisecond)), logging.Err(err))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return stopped(attempt, err, ctx.Err())
+		}
+	}
+}
+
+// stopped returns the error of an operation whose context is done with ctxErr
+// after attempt failed with err, so it is reported as cancelled or timed out.
+func stopped(attempt int, err error, ctxErr error) error {
+	if errors.Is(err, ctxErr) {
+		return err
+	}
+	return fmt.Errorf("stopped after %d attempts, last error %v: %w", attempt, err, ctxErr)
+}
+
+// delay returns the wait after the failed attempt: a random duration
+// between half and all of the delay doubled for every attempt before.
+func (policy RetryPolicy) delay(attempt int) time.Duration {
+	delay, maxDelay := policy.Delay, policy.MaxDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return delay/2 + time.Duration(jitter.Int63n(int64(delay/2)+1))
+}
+
+// jitter spreads the retries of separate processes, so it is seeded differently by each.
+var (
+	jitterMu sync.Mutex
+	jitter   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// permanentErrors are the kinds of failure repeating an operation cannot fix.
+var permanentErrors = []error{
+	context.Canceled,
+	errs.ErrAccessDenied,
+	errs.ErrConfigInvalid,
+	errs.ErrDecrypt,
+	errs.ErrChunkMissing,
+	errs.ErrInvalidHash,
+	ErrObjectNotFound,
+	ErrIntegrity,
+}
+
+// refusedMessages and quotaMessages are parts of the messages of the errors
+// the satellite returns for refused credentials and exceeded limits.
+var (
+	refusedMessages = []string{"unauthenticated", "unauthorized", "permission denied", "access denied", "invalid api"}
+	quotaMessages   = []string{"usage limit", "storage limit", "bandwidth limit", "quota"}
+)
+
+// Retryable reports whether an operation failing with err may succeed when repeated.
+// Network failures and timed out attempts are retryable; refused credentials, exceeded
+// limits, missing objects, cancellation and data that cannot be decrypted are not.
+func Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, permanent := range permanentErrors {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return !isRefused(err) && !containsAny(err, quotaMessages)
+}
+
+// isRefused reports whether err is Storj refusing the credentials.
+func isRefused(err error) bool {
+	return !errors.Is(err, errs.ErrAccessDenied) && containsAny(err, refusedMessages)
+}
+
+// containsAny reports whether the message of err contains one of parts, ignoring case.
+func containsAny(err error, parts []string) bool {
+	message := strings.ToLower(err.Error())
+	for _, part := range parts {
+		if strings.Contains(message, part) {
+			return true
+		}
+	}
+	return false
+}
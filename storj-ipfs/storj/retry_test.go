@@ -0,0 +1,223 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	errs "storj-ipfs/errs"
+)
+
+func TestRetryable(t *testing.T) {
+	for _, test := range []struct {
+		err       error
+		retryable bool
+	}{
+		{err: nil, retryable: false},
+		{err: errors.New("connection reset by peer"), retryable: true},
+		{err: fmt.Errorf("could not upload chunk 0: %w", errors.New("i/o timeout")), retryable: true},
+		{err: context.DeadlineExceeded, retryable: true},
+		{err: context.Canceled, retryable: false},
+		{err: fmt.Errorf("could not upload chunk 0: %w", context.Canceled), retryable: false},
+		{err: ErrObjectNotFound, retryable: false},
+		{err: fmt.Errorf("manifest: %w", ErrObjectNotFound), retryable: false},
+		{err: ErrIntegrity, retryable: false},
+		{err: errs.Wrap(errs.ErrAccessDenied, errors.New("refused"), "bucket"), retryable: false},
+		{err: errs.Wrap(errs.ErrConfigInvalid, nil, "bucket"), retryable: false},
+		{err: errs.Wrap(errs.ErrDecrypt, nil, "chunk 0"), retryable: false},
+		{err: fmt.Errorf("download: %w", errs.New(errs.ErrChunkMissing, "chunk 0")), retryable: false},
+		{err: errs.New(errs.ErrInvalidHash, "hash"), retryable: false},
+		// The daemon may be restarted.
+		{err: errs.New(errs.ErrDaemonUnavailable, "daemon"), retryable: true},
+		{err: errors.New("rpc error: Unauthenticated: invalid API key"), retryable: false},
+		{err: errors.New("Unauthorized API credentials"), retryable: false},
+		{err: errors.New("metainfo error: Permission Denied"), retryable: false},
+		{err: errors.New("Exceeded Usage Limit"), retryable: false},
+		{err: errors.New("project storage limit reached"), retryable: false},
+		{err: errors.New("bandwidth limit exceeded"), retryable: false},
+		{err: fmt.Errorf("could not upload: %w", errors.New("over quota")), retryable: false},
+	} {
+		if retryable := Retryable(test.err); retryable != test.retryable {
+			t.Errorf("%v: retryable %t, expected %t", test.err, retryable, test.retryable)
+		}
+	}
+}
+
+func TestRetryDo(t *testing.T) {
+	transient := errors.New("connection reset by peer")
+	refused := errors.New("rpc error: Unauthenticated")
+	denied := errs.New(errs.ErrAccessDenied, "bucket")
+	policy := RetryPolicy{Attempts: 3, Delay: time.Millisecond}
+
+	for _, test := range []struct {
+		name string
+		// results are returned by the attempts in turn, the last one by every further attempt.
+		results []error
+		calls   int
+		// is is the error, and message part of the message, of the returned error.
+		is      error
+		message string
+	}{
+		{name: "success", results: []error{nil}, calls: 1},
+		{name: "transient", results: []error{transient, transient, nil}, calls: 3},
+		{name: "attempts", results: []error{transient}, calls: 3, is: transient, message: "failed after 3 attempts"},
+		{name: "permanent", results: []error{transient, ErrObjectNotFound}, calls: 2, is: ErrObjectNotFound},
+		{name: "refused", results: []error{refused}, calls: 1, is: errs.ErrAccessDenied, message: "Storj refused the request"},
+		{name: "denied", results: []error{denied}, calls: 1, is: denied, message: "bucket"},
+		{name: "cancelled", results: []error{transient, context.Canceled}, calls: 2, is: context.Canceled},
+	} {
+		calls := 0
+		err := policy.Do(context.Background(), func(ctx context.Context) error {
+			calls++
+			if calls > len(test.results) {
+				return test.results[len(test.results)-1]
+			}
+			return test.results[calls-1]
+		})
+		if calls != test.calls {
+			t.Errorf("%s: %d attempts, expected %d", test.name, calls, test.calls)
+		}
+		if test.is == nil {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, test.is) || !strings.Contains(fmt.Sprint(err), test.message) {
+			t.Errorf("%s: %v, expected %v with %q", test.name, err, test.is, test.message)
+		}
+	}
+
+	// Cancelling the context stops the retries with its error, during the wait before the next attempt
+	// or during an attempt failing with another error.
+	for name, cancelDuring := range map[string]bool{"wait": false, "attempt": true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		start := time.Now()
+		err := RetryPolicy{Attempts: 3, Delay: time.Minute}.Do(ctx, func(ctx context.Context) error {
+			calls++
+			if cancelDuring {
+				cancel()
+			} else {
+				time.AfterFunc(20*time.Millisecond, cancel)
+			}
+			return transient
+		})
+		cancel()
+		if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), transient.Error()) || calls != 1 {
+			t.Errorf("cancelled %s: %v after %d attempts, expected %v with the last error after 1", name, err, calls, context.Canceled)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("cancelled %s: stopped after %v", name, elapsed)
+		}
+	}
+
+	// A refused request already reported as access denied is not wrapped again.
+	if err := policy.Do(context.Background(), func(ctx context.Context) error { return denied }); err != denied {
+		t.Errorf("denied: %v, expected %v", err, denied)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{Delay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for _, test := range []struct {
+		policy  RetryPolicy
+		attempt int
+		delay   time.Duration
+	}{
+		{policy: policy, attempt: 1, delay: 10 * time.Millisecond},
+		{policy: policy, attempt: 2, delay: 20 * time.Millisecond},
+		{policy: policy, attempt: 3, delay: 40 * time.Millisecond},
+		{policy: policy, attempt: 4, delay: 50 * time.Millisecond},
+		{policy: policy, attempt: 100, delay: 50 * time.Millisecond},
+		{policy: RetryPolicy{Delay: time.Minute, MaxDelay: time.Second}, attempt: 1, delay: time.Second},
+		{policy: RetryPolicy{}, attempt: 1, delay: DefaultRetryDelay},
+		{policy: RetryPolicy{}, attempt: 2, delay: 2 * DefaultRetryDelay},
+		{policy: RetryPolicy{}, attempt: 100, delay: DefaultRetryMaxDelay},
+	} {
+		// The delay is jittered between half and all of it.
+		for i := 0; i < 100; i++ {
+			if delay := test.policy.delay(test.attempt); delay < test.delay/2 || delay > test.delay {
+				t.Errorf("%+v attempt %d: delay %v, expected between %v and %v", test.policy, test.attempt, delay, test.delay/2, test.delay)
+				break
+			}
+		}
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	transient := errors.New("connection reset by peer")
+
+	// Attempts are repeated until the deadline.
+	policy := RetryPolicy{Attempts: 1000, Delay: 5 * time.Millisecond, MaxDelay: 5 * time.Millisecond, Deadline: 50 * time.Millisecond}
+	calls := 0
+	start := time.Now()
+	err := policy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return transient
+	})
+	if elapsed := time.Since(start); elapsed < policy.Deadline/2 || elapsed > time.Second {
+		t.Errorf("failed after %v, expected about %v", elapsed, policy.Deadline)
+	}
+	// The deadline may pass during the wait before the next attempt, stopping it with the context's error.
+	if !errors.Is(err, transient) && !(errors.Is(err, context.DeadlineExceeded) && strings.Contains(err.Error(), transient.Error())) {
+		t.Errorf("%v, expected %v", err, transient)
+	}
+	if calls < 2 || calls >= policy.Attempts {
+		t.Errorf("%d attempts within the deadline", calls)
+	}
+
+	// They stop without waiting when the next delay would pass the deadline.
+	policy = RetryPolicy{Attempts: 5, Delay: time.Second, Deadline: 50 * time.Millisecond}
+	calls = 0
+	start = time.Now()
+	err = policy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return transient
+	})
+	if elapsed := time.Since(start); elapsed > policy.Deadline {
+		t.Errorf("failed after %v, expected right away", elapsed)
+	}
+	if !errors.Is(err, transient) || !strings.Contains(err.Error(), "failed after 1 attempts, retry deadline reached") || calls != 1 {
+		t.Errorf("%v after %d attempts, expected the deadline to be reached after 1", err, calls)
+	}
+
+	// An attempt hanging past the deadline is stopped and not repeated.
+	policy = RetryPolicy{Attempts: 5, Delay: time.Millisecond, Deadline: 20 * time.Millisecond}
+	calls = 0
+	err = policy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || calls != 1 {
+		t.Errorf("%v after %d attempts, expected %v after 1", err, calls, context.DeadlineExceeded)
+	}
+}
+
+func TestParseRetryPolicy(t *testing.T) {
+	for _, test := range []struct {
+		attempts string
+		deadline string
+		policy   RetryPolicy
+	}{
+		{policy: RetryPolicy{}},
+		{attempts: "3", policy: RetryPolicy{Attempts: 3}},
+		{attempts: "1", deadline: "2m", policy: RetryPolicy{Attempts: 1, Deadline: 2 * time.Minute}},
+	} {
+		if policy, err := ParseRetryPolicy(test.attempts, test.deadline); err != nil || policy != test.policy {
+			t.Errorf("%q %q: %+v, expected %+v: %v", test.attempts, test.deadline, policy, test.policy, err)
+		}
+	}
+	for _, invalid := range [][2]string{{"0", ""}, {"-1", ""}, {"x", ""}, {"", "x"}, {"", "-1s"}} {
+		if _, err := ParseRetryPolicy(invalid[0], invalid[1]); !errors.Is(err, errs.ErrConfigInvalid) {
+			t.Errorf("%q %q: %v, expected %v", invalid[0], invalid[1], err, errs.ErrConfigInvalid)
+		}
+	}
+}
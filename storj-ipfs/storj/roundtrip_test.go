@@ -0,0 +1,221 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testUploadPath = "uploads/"
+	testBaseCID    = "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"
+	testFileName   = "file.bin"
+	testChunkSize  = 7000
+	testFileSize   = 10*testChunkSize + 123
+)
+
+// testChunkCID names chunks after the SHA-256 of their envelope, so the tests need no IPFS code.
+func testChunkCID(data io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// testStores returns the local ObjectStores every round trip runs against,
+// and a function removing the directory of the DirStore.
+func testStores(t *testing.T) (map[string]ObjectStore, func()) {
+	root, cleanup := tempDir(t)
+	dir, err := NewDirStore(root)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return map[string]ObjectStore{"MemStore": NewMemStore(), "DirStore": dir}, cleanup
+}
+
+// tempDir returns a new temporary directory and a function removing it.
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "storj-ipfs-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// testData returns size random bytes, the same for every call with the same seed.
+func testData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// testBoundaries returns the boundaries of data cut in chunks of testChunkSize.
+func testBoundaries(data []byte) Boundaries {
+	return &sizeBoundaries{size: testChunkSize, remaining: int64(len(data))}
+}
+
+// storeFile uploads data the way the store command does and returns its manifest.
+func storeFile(t *testing.T, store ObjectStore, data []byte, dataKey []byte, options UploadOptions) *Manifest {
+	ctx := context.Background()
+	options.Prefix = testUploadPath + testBaseCID + "/"
+	options.Algorithm = AlgorithmAESGCM
+	options.DataKey = dataKey
+	options.ChunkCID = testChunkCID
+
+	chunks, err := UploadChunks(ctx, store, bytes.NewReader(data), testBoundaries(data), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := &Manifest{
+		Version:  ManifestVersion,
+		FileName: testFileName,
+		FileSize: int64(len(data)),
+		Mode:     0640,
+		ModTime:  time.Date(2019, 10, 4, 12, 30, 0, 0, time.UTC),
+		Chunks:   chunks,
+	}
+	if err := UploadManifest(ctx, store, testUploadPath, testBaseCID, manifest, RetryPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+// checkDownload checks that the file downloaded to dir has the content, mode and modification time of data and manifest.
+func checkDownload(t *testing.T, dir string, data []byte, manifest *Manifest) {
+	fullPath := filepath.Join(dir, testFileName)
+	downloaded, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Fatalf("downloaded %d bytes that differ from the %d stored", len(downloaded), len(data))
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != os.FileMode(manifest.Mode) {
+		t.Errorf("mode %v, expected %v", info.Mode().Perm(), os.FileMode(manifest.Mode))
+	}
+	if !info.ModTime().Equal(manifest.ModTime) {
+		t.Errorf("modification time %v, expected %v", info.ModTime(), manifest.ModTime)
+	}
+}
+
+func TestStoreDownloadRoundTrip(t *testing.T) {
+	stores, cleanup := testStores(t)
+	defer cleanup()
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			dataKey, err := NewDataKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := testData(1, testFileSize)
+			manifest := storeFile(t, store, data, dataKey, UploadOptions{Concurrency: 3})
+			if len(manifest.Chunks) != 11 {
+				t.Fatalf("%d chunks, expected 11", len(manifest.Chunks))
+			}
+
+			dir, cleanup := tempDir(t)
+			defer cleanup()
+			if err := DownloadData(context.Background(), store, dir, testUploadPath, testBaseCID, testFileName, dataKey, 3, RetryPolicy{}); err != nil {
+				t.Fatal(err)
+			}
+			checkDownload(t, dir, data, manifest)
+
+			otherKey, err := NewDataKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			otherDir, cleanup := tempDir(t)
+			defer cleanup()
+			err = DownloadData(context.Background(), store, otherDir, testUploadPath, testBaseCID, testFileName, otherKey, 3, RetryPolicy{})
+			if !errors.Is(err, ErrIntegrity) {
+				t.Fatalf("download with another key: %v, expected %v", err, ErrIntegrity)
+			}
+		})
+	}
+}
+
+// errFaulty is the transient error of the stores failing on purpose.
+var errFaulty = errors.New("connection reset")
+
+func TestDownloadRejectsUnsafeName(t *testing.T) {
+	store := NewMemStore()
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeFile(t, store, testData(6, testChunkSize), dataKey, UploadOptions{})
+
+	root, cleanup := tempDir(t)
+	defer cleanup()
+	dir := filepath.Join(root, "download")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, fileName := range []string{"../" + testFileName, "/tmp/" + testFileName, "..", ""} {
+		if err := DownloadData(context.Background(), store, dir, testUploadPath, testBaseCID, fileName, dataKey, 1, RetryPolicy{}); err == nil {
+			t.Errorf("downloaded as %q", fileName)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, testFileName)); !os.IsNotExist(err) {
+		t.Errorf("downloaded outside the download directory: %v", err)
+	}
+}
+
+func TestDownloadLegacyOverStalePart(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	data := testData(7, 2*testChunkSize+10)
+
+	// Uploads made before manifests and data keys list their chunks in a comma-separated meta file.
+	var list string
+	for index := 0; index*testChunkSize < len(data); index++ {
+		end := (index + 1) * testChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		name := "QmChunk" + string(rune('A'+index))
+		if err := store.Put(ctx, testUploadPath+testBaseCID+"/"+name, bytes.NewReader(sealLegacy(t, legacyChunkKey, data[index*testChunkSize:end]))); err != nil {
+			t.Fatal(err)
+		}
+		list += name + ","
+	}
+	if err := store.Put(ctx, testUploadPath+MetaFileName(testBaseCID), strings.NewReader(list)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A longer partial file left by an earlier download does not leave its end behind.
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	if err := ioutil.WriteFile(filepath.Join(dir, "."+testFileName+".part"), testData(8, 3*testChunkSize), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := DownloadData(ctx, store, dir, testUploadPath, testBaseCID, testFileName, nil, 1, RetryPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := ioutil.ReadFile(filepath.Join(dir, testFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Fatalf("downloaded %d bytes that differ from the %d stored", len(downloaded), len(data))
+	}
+}
@@ -6,26 +6,21 @@ package storj
 import (
 	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
 	"os"
 	"strconv"
 	"strings"
 
+	errs "storj-ipfs/errs"
+	logging "storj-ipfs/logging"
+	timeouts "storj-ipfs/timeouts"
+
 	"storj.io/storj/lib/uplink"
 	"storj.io/storj/pkg/macaroon"
 )
 
-// DEBUG allows more detailed working to be exposed through the terminal.
-var DEBUG = false
-
 // ConfigStorj depicts keys to search for within the stroj_config.json file.
 type ConfigStorj struct {
 	APIKey               string `json:"apiKey"`
@@ -35,340 +30,368 @@ type ConfigStorj struct {
 	EncryptionPassphrase string `json:"encryptionPassphrase"`
 	SerializedScope      string `json:"serializedScope"`
 	Key                  string `json:"key"`
+	Cipher               string `json:"cipher"`
+	Concurrency          string `json:"concurrency"`
 	DisallowReads        string `json:"disallowReads"`
 	DisallowWrites       string `json:"disallowWrites"`
 	DisallowDeletes      string `json:"disallowDeletes"`
+	// DedupSecret, if set, stores chunks once per bucket under the shared chunks/ prefix.
+	DedupSecret string `json:"dedupSecret"`
+	// ConnectTimeout bounds opening the project and bucket, as a duration such as "30s".
+	ConnectTimeout string `json:"connectTimeout"`
+	// ObjectTimeout bounds each upload or download of a chunk or meta file, as a duration such as "5m".
+	ObjectTimeout string `json:"objectTimeout"`
+	// RetryAttempts is the most attempts at each upload or download of a chunk or meta file.
+	RetryAttempts string `json:"retryAttempts"`
+	// RetryDeadline bounds all attempts at each upload or download together, as a duration such as "10m".
+	RetryDeadline string `json:"retryDeadline"`
 }
 
-// LoadStorjConfiguration reads and parses the JSON file that contain Storj configuration information.
-func LoadStorjConfiguration(fullFileName string) (ConfigStorj, error) { // fullFileName for fetching storj V3 credentials from  given JSON filename.
+// LoadStorjConfiguration reads and parses the JSON file that contain Storj configuration information,
+// logging it to logger without the secrets.
+func LoadStorjConfiguration(fullFileName string, logger *logging.Logger) (ConfigStorj, error) { // fullFileName for fetching storj V3 credentials from  given JSON filename.
 
 	var configStorj ConfigStorj
 
 	fileHandle, err := os.Open(fullFileName)
 	if err != nil {
-		return configStorj, err
+		return configStorj, errs.Wrap(errs.ErrConfigInvalid, err, "Could not read Storj configuration")
 	}
 	defer fileHandle.Close()
 
 	jsonParser := json.NewDecoder(fileHandle)
-	jsonParser.Decode(&configStorj)
+	if err := jsonParser.Decode(&configStorj); err != nil {
+		return configStorj, errs.Wrap(errs.ErrConfigInvalid, err, "Invalid Storj configuration %q", fullFileName)
+	}
+
+	// Log read information.
+	logger.Info("Read Storj configuration",
+		logging.Any("file", fullFileName),
+		logging.Secret("apiKey", configStorj.APIKey),
+		logging.Any("satellite", configStorj.Satellite),
+		logging.Any("bucket", configStorj.Bucket),
+		logging.Any("uploadPath", configStorj.UploadPath),
+		logging.Secret("serializedScope", configStorj.SerializedScope))
 
 	return configStorj, nil
 }
 
-// ConnectStorjReadUploadData reads Storj configuration from given file,
-// connects to the desired Storj network.
-// It then reads data property from an external file.
-func ConnectStorjReadUploadData(fullFileName string, keyValue string, restrict string) (context.Context, *uplink.Uplink, *uplink.Project, *uplink.Bucket, ConfigStorj, string, error) { // fullFileName for fetching storj V3 credentials from  given JSON filename
-	// databaseReader is an io.Reader implementation that 'reads' desired data,
-	// which is to be uploaded to storj V3 network.
-	// databaseName for adding dataBase name in storj V3 filename.
-	// Read Storj bucket's configuration from an external file.
-	var scope string
-	configStorj, err := LoadStorjConfiguration(fullFileName)
-	if err != nil {
-		//return
-		fmt.Printf("loadStorjConfiguration: %s", err)
+// partnerID is the partner id every uplink is configured with.
+const partnerID = "a1ba07a4-e095-4a43-914c-1d56c9ff5afd"
+
+// Access holds the credentials a bucket is opened with.
+type Access struct {
+	// UseAPIKey opens the bucket with APIKey, Satellite and EncryptionPassphrase
+	// instead of the serialized scope key.
+	UseAPIKey            bool
+	APIKey               string
+	Satellite            string
+	EncryptionPassphrase string
+	SerializedScope      string
+}
+
+// Access returns the credentials of the configuration.
+// useAPIKey selects the API key instead of the serialized scope key.
+func (configStorj ConfigStorj) Access(useAPIKey bool) Access {
+	return Access{
+		UseAPIKey:            useAPIKey,
+		APIKey:               configStorj.APIKey,
+		Satellite:            configStorj.Satellite,
+		EncryptionPassphrase: configStorj.EncryptionPassphrase,
+		SerializedScope:      configStorj.SerializedScope,
 	}
+}
 
-	// Display read information.
-	fmt.Println("\nReading Storj configuration from file: ", fullFileName)
-	fmt.Println("API Key\t\t\t: ", configStorj.APIKey)
-	fmt.Println("Satellite\t	: ", configStorj.Satellite)
-	fmt.Println("Bucket	\t	: ", configStorj.Bucket)
-	fmt.Println("Upload Path\t\t: ", configStorj.UploadPath)
-	fmt.Println("Serialized Scope Key\t: ", configStorj.SerializedScope)
+// Connection is a bucket opened on the Storj network, with the project and uplink it was opened through.
+// A Connection with only a Store, such as a DirStore, has nothing to close and no scope key.
+type Connection struct {
+	// Store reads and writes the objects of the bucket.
+	Store ObjectStore
 
-	fmt.Println("\nCreating New Uplink...")
+	scope   *uplink.Scope
+	uplink  *uplink.Uplink
+	project *uplink.Project
+	bucket  *uplink.Bucket
+}
 
+// Connect opens the bucket bucketName with access, creating it first if create is set
+// and it cannot be opened. The caller must Close the returned connection.
+func Connect(ctx context.Context, access Access, bucketName string, create bool) (*Connection, error) {
 	var cfg uplink.Config
 	// Configure the partner id
-	cfg.Volatile.PartnerID = "a1ba07a4-e095-4a43-914c-1d56c9ff5afd"
+	cfg.Volatile.PartnerID = partnerID
 
-	ctx := context.Background()
+	scope, err := openScope(ctx, &cfg, access)
+	if err != nil {
+		return nil, err
+	}
 
 	uplinkstorj, err := uplink.NewUplink(ctx, &cfg)
 	if err != nil {
-		uplinkstorj.Close()
-		log.Fatal("Could not create new Uplink object:", err)
+		return nil, fmt.Errorf("Could not create new Uplink object: %w", err)
+	}
+	proj, err := uplinkstorj.OpenProject(ctx, scope.SatelliteAddr, scope.APIKey)
+	if err != nil {
+		CloseProject(uplinkstorj, nil, nil)
+		return nil, errs.Wrap(errs.ErrAccessDenied, err, "Could not open project")
 	}
-	var serializedScope string
-	if keyValue == "key" {
-		fmt.Println("Parsing the API key...")
-		key, err := uplink.ParseAPIKey(configStorj.APIKey)
-		if err != nil {
-			uplinkstorj.Close()
-			log.Fatal("Could not parse API key:", err)
-		}
-
-		if DEBUG {
-			fmt.Println("API key \t   :", configStorj.APIKey)
-			fmt.Println("Serialized API key :", key.Serialize())
-		}
-
-		fmt.Println("Opening Project...")
-		proj, err := uplinkstorj.OpenProject(ctx, configStorj.Satellite, key)
 
-		if err != nil {
+	logger := logging.FromContext(ctx).With(logging.Any("bucket", bucketName))
+	logger.Info("Opening bucket")
+	// Open up the desired Bucket within the Project.
+	bucket, err := proj.OpenBucket(ctx, bucketName, scope.EncryptionAccess)
+	if err != nil && create {
+		logger.Info("Could not open bucket, creating it", logging.Err(err))
+		if _, err := proj.CreateBucket(ctx, bucketName, nil); err != nil {
 			CloseProject(uplinkstorj, proj, nil)
-			log.Fatal("Could not open project:", err)
+			return nil, errs.Wrap(errs.ErrAccessDenied, err, "Could not create bucket %q", bucketName)
 		}
+		logger.Info("Created bucket")
+		bucket, err = proj.OpenBucket(ctx, bucketName, scope.EncryptionAccess)
+	}
+	if err != nil {
+		CloseProject(uplinkstorj, proj, nil)
+		return nil, errs.Wrap(errs.ErrAccessDenied, err, "Could not open bucket %q", bucketName)
+	}
 
-		// Creating an encryption key from encryption passphrase.
-		if DEBUG {
-			fmt.Println("\nGetting encryption key from pass phrase...")
-		}
+	return &Connection{
+		Store:   NewUplinkStore(bucket),
+		scope:   scope,
+		uplink:  uplinkstorj,
+		project: proj,
+		bucket:  bucket,
+	}, nil
+}
 
-		encryptionKey, err := proj.SaltedKeyFromPassphrase(ctx, configStorj.EncryptionPassphrase)
+// openScope returns the scope of access: its parsed serialized scope key, or the API key
+// with the encryption key the satellite derives from the encryption passphrase.
+func openScope(ctx context.Context, cfg *uplink.Config, access Access) (*uplink.Scope, error) {
+	if !access.UseAPIKey {
+		scope, err := uplink.ParseScope(access.SerializedScope)
 		if err != nil {
-			CloseProject(uplinkstorj, proj, nil)
-			log.Fatal("Could not create encryption key:", err)
+			return nil, errs.Wrap(errs.ErrConfigInvalid, err, "Could not parse serialized scope key")
 		}
+		return scope, nil
+	}
 
-		// Creating an encryption context.
-		access := uplink.NewEncryptionAccessWithDefaultKey(*encryptionKey)
-		if DEBUG {
-			fmt.Println("Encryption access \t:", configStorj.EncryptionPassphrase)
-		}
-		// Serializing the parsed access, so as to compare with the original key.
-		serializedAccess, err := access.Serialize()
-		if err != nil {
-			CloseProject(uplinkstorj, proj, nil)
-			log.Fatal("Error Serialized key : ", err)
+	logger := logging.FromContext(ctx)
+	logger.Debug("Parsing the API key", logging.Secret("apiKey", access.APIKey))
+	key, err := uplink.ParseAPIKey(access.APIKey)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrConfigInvalid, err, "Could not parse API key")
+	}
 
-		}
-		if DEBUG {
-			fmt.Println("Serialized access key\t:", serializedAccess)
-		}
+	uplinkstorj, err := uplink.NewUplink(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create new Uplink object: %w", err)
+	}
+	defer uplinkstorj.Close()
 
-		// Load the existing encryption access context
-		accessParse, err := uplink.ParseEncryptionAccess(serializedAccess)
-		if err != nil {
-			log.Fatal(err)
-		}
+	logger.Debug("Opening project", logging.Any("satellite", access.Satellite))
+	proj, err := uplinkstorj.OpenProject(ctx, access.Satellite, key)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrAccessDenied, err, "Could not open project")
+	}
+	defer proj.Close()
 
-		if restrict == "restrict" {
-			disallowRead, _ := strconv.ParseBool(configStorj.DisallowReads)
-			disallowWrite, _ := strconv.ParseBool(configStorj.DisallowWrites)
-			disallowDelete, _ := strconv.ParseBool(configStorj.DisallowDeletes)
-			userAPIKey, err := key.Restrict(macaroon.Caveat{
-				DisallowReads:   disallowRead,
-				DisallowWrites:  disallowWrite,
-				DisallowDeletes: disallowDelete,
-			})
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			userAPIKey, userAccess, err := accessParse.Restrict(userAPIKey,
-				uplink.EncryptionRestriction{
-					Bucket:     configStorj.Bucket,
-					PathPrefix: configStorj.UploadPath,
-				},
-			)
-			if err != nil {
-				log.Fatal(err)
-			}
-			userRestrictScope := &uplink.Scope{
-				SatelliteAddr:    configStorj.Satellite,
-				APIKey:           userAPIKey,
-				EncryptionAccess: userAccess,
-			}
-			serializedRestrictScope, err := userRestrictScope.Serialize()
-			if err != nil {
-				log.Fatal(err)
-			}
-			scope = serializedRestrictScope
-			//fmt.Println("Restricted serialized user scope", serializedRestrictScope)
-		}
+	// Creating an encryption key from encryption passphrase.
+	logger.Debug("Getting encryption key from passphrase", logging.Secret("encryptionPassphrase", access.EncryptionPassphrase))
 
-		userScope := &uplink.Scope{
-			SatelliteAddr:    configStorj.Satellite,
-			APIKey:           key,
-			EncryptionAccess: access,
-		}
-		serializedScope, err = userScope.Serialize()
-		if err != nil {
-			log.Fatal(err)
-		}
-		if restrict == "" {
-			scope = serializedScope
-			//fmt.Println("serialized user scope", serializedScope)
-		}
+	encryptionKey, err := proj.SaltedKeyFromPassphrase(ctx, access.EncryptionPassphrase)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrAccessDenied, err, "Could not create encryption key")
+	}
 
-		proj.Close()
-		uplinkstorj.Close()
-	} else {
-		serializedScope = configStorj.SerializedScope
+	// Creating an encryption context.
+	encryptionAccess := uplink.NewEncryptionAccessWithDefaultKey(*encryptionKey)
+
+	return &uplink.Scope{
+		SatelliteAddr:    access.Satellite,
+		APIKey:           key,
+		EncryptionAccess: encryptionAccess,
+	}, nil
+}
 
+// Scope returns the serialized scope key the bucket was opened with.
+func (connection *Connection) Scope() (string, error) {
+	if connection.scope == nil {
+		return "", nil
 	}
-	parsedScope, err := uplink.ParseScope(serializedScope)
+	serializedScope, err := connection.scope.Serialize()
 	if err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("Could not serialize scope key: %w", err)
 	}
+	return serializedScope, nil
+}
 
-	uplinkstorj, err = uplink.NewUplink(ctx, &cfg)
+// RestrictedScope returns a serialized scope key for the upload path of configStorj
+// in the bucket, without the permissions its disallow settings take away.
+func (connection *Connection) RestrictedScope(configStorj ConfigStorj) (string, error) {
+	if connection.scope == nil {
+		return "", nil
+	}
+	disallowRead, _ := strconv.ParseBool(configStorj.DisallowReads)
+	disallowWrite, _ := strconv.ParseBool(configStorj.DisallowWrites)
+	disallowDelete, _ := strconv.ParseBool(configStorj.DisallowDeletes)
+	userAPIKey, err := connection.scope.APIKey.Restrict(macaroon.Caveat{
+		DisallowReads:   disallowRead,
+		DisallowWrites:  disallowWrite,
+		DisallowDeletes: disallowDelete,
+	})
 	if err != nil {
-		log.Fatal("Could not create new Uplink object:", err)
+		return "", fmt.Errorf("Could not restrict API key: %w", err)
 	}
-	proj, err := uplinkstorj.OpenProject(ctx, parsedScope.SatelliteAddr, parsedScope.APIKey)
+
+	userAPIKey, userAccess, err := connection.scope.EncryptionAccess.Restrict(userAPIKey,
+		uplink.EncryptionRestriction{
+			Bucket:     configStorj.Bucket,
+			PathPrefix: configStorj.UploadPath,
+		},
+	)
 	if err != nil {
-		CloseProject(uplinkstorj, proj, nil)
-		log.Fatal("Could not open project:", err)
+		return "", fmt.Errorf("Could not restrict encryption access: %w", err)
+	}
+	userRestrictScope := &uplink.Scope{
+		SatelliteAddr:    connection.scope.SatelliteAddr,
+		APIKey:           userAPIKey,
+		EncryptionAccess: userAccess,
 	}
+	serializedRestrictScope, err := userRestrictScope.Serialize()
+	if err != nil {
+		return "", fmt.Errorf("Could not serialize scope key: %w", err)
+	}
+	return serializedRestrictScope, nil
+}
 
-	fmt.Println("Opening Bucket\t: ", configStorj.Bucket)
-	// Open up the desired Bucket within the Project.
-	bucket, err := proj.OpenBucket(ctx, configStorj.Bucket, parsedScope.EncryptionAccess)
+// Close closes the bucket, project and uplink of the connection.
+func (connection *Connection) Close() {
+	CloseProject(connection.uplink, connection.project, connection.bucket)
+	connection.uplink, connection.project, connection.bucket = nil, nil, nil
+}
+
+// ConnectStorjReadUploadData reads Storj configuration from given file,
+// connects to the desired Storj network and opens the bucket, creating it if needed.
+// It returns the bucket as an ObjectStore bounded by the object timeout, and a function closing it.
+// With keyValue "key" the API key is used and the serialized scope key to share is returned,
+// restricted by the disallow settings if restrict is "restrict".
+func ConnectStorjReadUploadData(ctx context.Context, fullFileName string, keyValue string, restrict string) (ObjectStore, func(), ConfigStorj, string, error) { // fullFileName for fetching storj V3 credentials from  given JSON filename
+	// Read Storj bucket's configuration from an external file.
+	configStorj, err := LoadStorjConfiguration(fullFileName, logging.FromContext(ctx))
+	if err != nil {
+		return nil, nil, configStorj, "", fmt.Errorf("Could not load Storj configuration: %w", err)
+	}
+
+	logging.FromContext(ctx).Debug("Creating new uplink")
+	connection, err := connectConfigured(ctx, configStorj, keyValue == "key", configStorj.Bucket, true)
 	if err != nil {
-		fmt.Println("Could not open bucket", configStorj.Bucket, ":", err)
-		fmt.Println("Trying to create new bucket....")
-		_, err1 := proj.CreateBucket(ctx, configStorj.Bucket, nil)
-		if err1 != nil {
-			CloseProject(uplinkstorj, proj, bucket)
-			fmt.Printf("Could not create bucket %q:", configStorj.Bucket)
-			log.Fatal(err1)
+		return nil, nil, configStorj, "", err
+	}
+
+	var scope string
+	if keyValue == "key" {
+		if restrict == "restrict" {
+			scope, err = connection.RestrictedScope(configStorj)
 		} else {
-			fmt.Println("Created Bucket", configStorj.Bucket)
+			scope, err = connection.Scope()
 		}
-		fmt.Println("Opening created Bucket: ", configStorj.Bucket)
-		bucket, err = proj.OpenBucket(ctx, configStorj.Bucket, parsedScope.EncryptionAccess)
 		if err != nil {
-			fmt.Printf("Could not open bucket %q: %s", configStorj.Bucket, err)
+			connection.Close()
+			return nil, nil, configStorj, "", err
 		}
 	}
-	return ctx, uplinkstorj, proj, bucket, configStorj, scope, err
+	return connection.Store, connection.Close, configStorj, scope, nil
 }
 
-// ConnectUpload uploads the data to storj network.
-func ConnectUpload(ctx context.Context, bucket *uplink.Bucket, data []byte, databaseName string, fileNamesDEBUG []string, configStorj ConfigStorj, err error) ([]string, bool) {
-	// Read data using bytes and upload it to Storj.
-	var file []string
-	file = fileNamesDEBUG
-	var uploadComplete = false
-	for err = io.ErrShortBuffer; err == io.ErrShortBuffer; {
-
-		var filename = databaseName
-		var retryCount = 0
-		checkSlash := configStorj.UploadPath[len(configStorj.UploadPath)-1:]
-		if checkSlash != "/" {
-			configStorj.UploadPath = configStorj.UploadPath + "/"
-		}
-		fmt.Println("\nUpload Object Path: ", configStorj.UploadPath+filename)
-		fmt.Printf("Upload %d bytes of object to Storj bucket: Initiated...\n", len(data))
-
-		for retryCount < 5 {
-			readerBytes := bytes.NewReader(data)
-			readerIO := io.Reader(readerBytes)
-			err = bucket.UploadObject(ctx, configStorj.UploadPath+filename, readerIO, nil)
-			if err != nil {
-				retryCount++
-				fmt.Println("Retrying...")
-			} else {
-				uploadComplete = true
-				break
-			}
-		}
+// connectConfigured opens bucketName with the credentials of configStorj, the API key if useAPIKey,
+// within its connect timeout, and bounds every object operation by its object timeout.
+func connectConfigured(ctx context.Context, configStorj ConfigStorj, useAPIKey bool, bucketName string, create bool) (*Connection, error) {
+	connectTimeout, err := timeouts.Parse(configStorj.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	objectTimeout, err := timeouts.Parse(configStorj.ObjectTimeout)
+	if err != nil {
+		return nil, err
+	}
 
-		if DEBUG {
-			file = append(file, filename)
-		}
+	connectCtx, cancel := WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	connection, err := Connect(connectCtx, configStorj.Access(useAPIKey), bucketName, create)
+	if err != nil {
+		return nil, err
 	}
+	connection.Store = StoreWithTimeout(connection.Store, objectTimeout)
+	return connection, nil
+}
 
+// ConnectUpload uploads the data to storj network under databaseName in the upload path.
+func ConnectUpload(ctx context.Context, store ObjectStore, data []byte, databaseName string, configStorj ConfigStorj) error {
+	// Read data using bytes and upload it to Storj.
+	logger := logging.FromContext(ctx)
+	retry, err := ParseRetryPolicy(configStorj.RetryAttempts, configStorj.RetryDeadline)
 	if err != nil {
-		fmt.Printf("Could not upload: %s", err)
-		return nil, uploadComplete
+		return err
 	}
 
-	fmt.Println("Uploading object to Storj bucket: Completed!")
-	return file, uploadComplete
-}
+	var filename = databaseName
+	checkSlash := configStorj.UploadPath[len(configStorj.UploadPath)-1:]
+	if checkSlash != "/" {
+		configStorj.UploadPath = configStorj.UploadPath + "/"
+	}
+	logger.Info("Uploading object", logging.Any("object", configStorj.UploadPath+filename), logging.Any("size", len(data)))
 
-// Debug function downloads the data from storj bucket after upload to verify data is uploaded successfully.
-func Debug(bucket *uplink.Bucket, metaFileName string, configStorj ConfigStorj, lastFileName string) {
+	// Transient failures are retried by retry.
+	if err := uploadObject(ctx, store, configStorj.UploadPath+filename, data, retry); err != nil {
+		return fmt.Errorf("could not upload %s: %w", configStorj.UploadPath+filename, err)
+	}
 
-	if DEBUG {
-		ctx := context.Background()
-		splitCid := strings.Split(string(metaFileName), "/")
-		baseCID := splitCid[0]
-		checkSlash := configStorj.UploadPath[len(configStorj.UploadPath)-1:]
-		if checkSlash != "/" {
-			configStorj.UploadPath = configStorj.UploadPath + "/"
-		}
-		//Get Meta data file from storj
-		readBackMeta, err := bucket.OpenObject(ctx, configStorj.UploadPath+metaFileName)
-		if err != nil {
-			fmt.Printf("Could not open object at %s: ", configStorj.UploadPath+metaFileName)
-			log.Fatal(err)
+	logger.Info("Uploaded object")
+	return nil
+}
 
-		}
-		defer readBackMeta.Close()
+// uploadObject uploads data to path, retrying as retry allows.
+func uploadObject(ctx context.Context, store ObjectStore, path string, data []byte, retry RetryPolicy) error {
+	return uploadStream(ctx, store, path, func() (io.Reader, error) {
+		return bytes.NewReader(data), nil
+	}, retry)
+}
 
-		// We want the whole thing, so r a nge from 0 to -1.
-		strmMeta, err := readBackMeta.DownloadRange(ctx, 0, -1)
+// uploadStream uploads the data read from a reader returned by open to path,
+// retrying as retry allows with a new reader from open.
+func uploadStream(ctx context.Context, store ObjectStore, path string, open func() (io.Reader, error), retry RetryPolicy) error {
+	return retry.Do(ctx, func(ctx context.Context) error {
+		reader, err := open()
 		if err != nil {
-			log.Fatal("Could not initiate download:", err)
+			return err
 		}
-		defer strmMeta.Close()
-
-		// Read everything from the stream.
-		receivedContentsMeta, err := ioutil.ReadAll(strmMeta)
-
-		//Convert byte array into String
-		receiveContentsMeta := string(receivedContentsMeta)
-		receiveContentsMeta = strings.TrimSuffix(receiveContentsMeta, ",")
-
-		downloadFileNamesDEBUG := strings.Split(receiveContentsMeta, ",")
-
-		os.Remove("debug/" + lastFileName)
-
-		var downloadFileDisk *os.File
-		for _, filename := range downloadFileNamesDEBUG {
-			// Test uploaded data by downloading it.
-			// serializedAccess, err := access.Serialize().
-			// Initiate a download of the same object again.
-			readBack, err := bucket.OpenObject(ctx, configStorj.UploadPath+baseCID+"/"+filename)
-			if err != nil {
-				fmt.Printf("Could not open object at %q: %v", configStorj.UploadPath+baseCID+"/"+filename, err)
-				log.Fatal(err)
-			}
-			defer readBack.Close()
-
-			fmt.Println("\nDownloading file uploaded on storj...")
-			// We want the whole thing, so range from 0 to -1.
-			strm, err := readBack.DownloadRange(ctx, 0, -1)
-			if err != nil {
-				fmt.Printf("Could not initiate download: %v", err)
-			}
-			defer strm.Close()
-			fmt.Printf("Downloading Object %s from bucket : Initiated...\n", filename)
-			// Read everything from the stream.
-			receivedContents, err := ioutil.ReadAll(strm)
-			if err != nil {
-				fmt.Printf("Could not read object: %v", err)
-			}
-
-			//Decrypt the storj data
-			hmkey := []byte("This is a storj ipfs private key")
-			dec, _ := decrypt(hmkey, receivedContents)
-
-			downloadFileDisk, _ = os.OpenFile("debug/"+lastFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			_, err = downloadFileDisk.Write(dec)
-			if err != nil {
-				log.Fatal(err)
-			}
-			defer downloadFileDisk.Close()
-			readBack.Close()
-			strm.Close()
-			downloadFileDisk.Close()
-			fmt.Printf("Downloaded %d bytes of Object from bucket!\n", len(receivedContents))
+		return store.Put(ctx, path, reader)
+	})
+}
 
-		}
-		fmt.Printf("File downloading: Complete!\n")
-		fmt.Printf("\nDebug file \"%s\" downloaded to \"%s\"\n", lastFileName, "debug/")
+// Debug function downloads the data from storj bucket after upload into the debug folder to verify data is uploaded successfully.
+// dataKey is the per-file key the chunks were encrypted with.
+func Debug(ctx context.Context, store ObjectStore, metaFileName string, configStorj ConfigStorj, lastFileName string, dataKey []byte) error {
+	splitCid := strings.Split(string(metaFileName), "/")
+	baseCID := splitCid[0]
+	checkSlash := configStorj.UploadPath[len(configStorj.UploadPath)-1:]
+	if checkSlash != "/" {
+		configStorj.UploadPath = configStorj.UploadPath + "/"
+	}
+	// Download the uploaded file again through the regular download path.
+	concurrency, err := ParseConcurrency(configStorj.Concurrency)
+	if err != nil {
+		return err
 	}
-
+	retry, err := ParseRetryPolicy(configStorj.RetryAttempts, configStorj.RetryDeadline)
+	if err != nil {
+		return err
+	}
+	err = DownloadData(ctx, store, "debug", configStorj.UploadPath, baseCID, lastFileName, dataKey, concurrency, retry)
+	if err != nil {
+		return fmt.Errorf("Could not download debug file: %w", err)
+	}
+	logging.FromContext(ctx).Info("Downloaded debug file", logging.Any("file", lastFileName), logging.Any("path", "debug/"))
+	return nil
 }
 
 // CloseProject closes bucket, project and uplink.
@@ -397,285 +420,56 @@ type DownloadConfigStorj struct {
 	EncryptionPassphrase string `json:"encryptionPassphrase"`
 	SerializedScope      string `json:"serializedScope"`
 	Key                  string `json:"key"`
+	Concurrency          string `json:"concurrency"`
+	ConnectTimeout       string `json:"connectTimeout"`
+	ObjectTimeout        string `json:"objectTimeout"`
+	RetryAttempts        string `json:"retryAttempts"`
+	RetryDeadline        string `json:"retryDeadline"`
+	// IPFSTimeout bounds each request to the IPFS daemon.
+	IPFSTimeout string `json:"ipfsTimeout"`
 }
 
-// DownloadStorjConfiguration reads and parses the JSON file that contain Storj configuration information.
-func DownloadStorjConfiguration(fullFileName string) (DownloadConfigStorj, error) { // fullFileName for fetching storj V3 credentials from  given JSON filename.
+// DownloadStorjConfiguration reads and parses the JSON file that contain Storj configuration information,
+// logging it to logger without the secrets.
+func DownloadStorjConfiguration(fullFileName string, logger *logging.Logger) (DownloadConfigStorj, error) { // fullFileName for fetching storj V3 credentials from  given JSON filename.
 
 	var downloadConfigStorj DownloadConfigStorj
 
 	fileHandle, err := os.Open(fullFileName)
 	if err != nil {
-		return downloadConfigStorj, err
+		return downloadConfigStorj, errs.Wrap(errs.ErrConfigInvalid, err, "Could not read download configuration")
 	}
 	defer fileHandle.Close()
 
 	jsonParser := json.NewDecoder(fileHandle)
-	jsonParser.Decode(&downloadConfigStorj)
-
-	// Display read information.
-	fmt.Println("\nReading Download configuration from file: ", fullFileName)
-	fmt.Println("Host Name\t\t: ", downloadConfigStorj.HostName)
-	fmt.Println("Port\t\t\t: ", downloadConfigStorj.Port)
-	fmt.Println("Download Path\t\t: ", downloadConfigStorj.DownloadPath)
-	fmt.Println("Serialized Scope Key\t: ", downloadConfigStorj.SerializedScope)
-
-	return downloadConfigStorj, nil
-}
-
-// ConnectStorjReadDownloadData function downloads data from Storj
-func ConnectStorjReadDownloadData(downloadConfigStorj DownloadConfigStorj, readFile *bytes.Reader, keyValue string) error {
-	var downloadAPIKey string
-	var downloadSatellite string
-	var downloadBucket string
-	var downloadPath string
-	var downloadFileName string
-	var serializedScope string
-	makebuffer := make([]byte, 46)
-
-	// Read data from IPFS
-	readHashData, err := readFile.Read(makebuffer)
-	if err != nil {
-		fmt.Println("Error reading file:", err)
-	}
-
-	// Seperate the Hash and configration data
-	data := []byte(makebuffer[0:readHashData])
-	downloadFileName = string(data)
-	downloadFileSize := readFile.Size()
-
-	restDataBuf := make([]byte, downloadFileSize-46)
-	readRestFile, err := readFile.Read(restDataBuf)
-	if err != nil {
-		fmt.Println("Error reading file:", err)
-	}
-
-	dataEnc := []byte(restDataBuf[0:readRestFile])
-	pkey := []byte(downloadConfigStorj.Key)
-
-	// Decrypt the configration data
-	decryptData, err := decrypt(pkey, dataEnc)
-	if err != nil {
-		log.Fatal(err)
+	if err := jsonParser.Decode(&downloadConfigStorj); err != nil {
+		return downloadConfigStorj, errs.Wrap(errs.ErrConfigInvalid, err, "Invalid download configuration %q", fullFileName)
 	}
 
-	// Create directory if not present
-	if _, err := os.Stat(downloadConfigStorj.DownloadPath); os.IsNotExist(err) {
-		err1 := os.Mkdir(downloadConfigStorj.DownloadPath, os.ModeDir)
-		if err1 != nil {
-			log.Fatal("Invalid Download Path")
-		}
-	}
-
-	// Split the configration data
-	splitStorjData := strings.Split(string(decryptData), ",")
-	downloadAPIKey = downloadConfigStorj.APIKey          //splitStorjData[0]
-	downloadSatellite = downloadConfigStorj.SatelliteURL //splitStorjData[1]
-	downloadBucket = splitStorjData[0]
-	downloadPath = splitStorjData[1]
-	lastFileName := splitStorjData[2]
-
-	// Configure the partner id
-	var cfg uplink.Config
-	cfg.Volatile.PartnerID = "a1ba07a4-e095-4a43-914c-1d56c9ff5afd"
-	ctx := context.Background()
-
-	uplinkstorj, err := uplink.NewUplink(ctx, &cfg)
-	if err != nil {
-		return fmt.Errorf("Could not create new Uplink object: %s", err)
-	}
-	defer uplinkstorj.Close()
+	// Log read information.
+	logger.Info("Read download configuration",
+		logging.Any("file", fullFileName),
+		logging.Any("hostName", downloadConfigStorj.HostName),
+		logging.Any("port", downloadConfigStorj.Port),
+		logging.Any("downloadPath", downloadConfigStorj.DownloadPath),
+		logging.Secret("serializedScope", downloadConfigStorj.SerializedScope))
 
-	if keyValue == "key" {
-		fmt.Println("Parsing the API key...")
-		key, err := uplink.ParseAPIKey(downloadAPIKey)
-		if err != nil {
-			return fmt.Errorf("Could not parse API key: %s", err)
-		}
-
-		if DEBUG {
-			fmt.Println("API key \t   :", downloadAPIKey)
-			fmt.Println("Serialized API key :", key.Serialize())
-		}
-
-		// Open the project
-		fmt.Println("Opening Project...")
-		proj, err := uplinkstorj.OpenProject(ctx, downloadSatellite, key)
-
-		if err != nil {
-			return fmt.Errorf("Could not open project: %s", err)
-		}
-		defer proj.Close()
-
-		// Creating an encryption key from encryption passphrase.
-		if DEBUG {
-			fmt.Println("\nGetting encryption key from pass phrase...")
-		}
-
-		encryptionKey, err := proj.SaltedKeyFromPassphrase(ctx, downloadConfigStorj.EncryptionPassphrase)
-		if err != nil {
-			return fmt.Errorf("Could not create encryption key: %s", err)
-		}
-
-		// Creating an encryption context.
-		access := uplink.NewEncryptionAccessWithDefaultKey(*encryptionKey)
-		if DEBUG {
-			fmt.Println("Encryption access \t:", downloadConfigStorj.EncryptionPassphrase)
-		}
-
-		// Serializing the parsed access, so as to compare with the original key.
-		serializedAccess, err := access.Serialize()
-		if err != nil {
-			fmt.Println("Error Serialized key : ", err)
-		}
-
-		if DEBUG {
-			fmt.Println("Serialized access key\t:", serializedAccess)
-		}
-
-		userScope := &uplink.Scope{
-			SatelliteAddr:    downloadConfigStorj.SatelliteURL,
-			APIKey:           key,
-			EncryptionAccess: access,
-		}
-		serializedScope, err = userScope.Serialize()
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		proj.Close()
-		uplinkstorj.Close()
-	} else {
-		serializedScope = downloadConfigStorj.SerializedScope
-
-	}
-	parsedScope, err := uplink.ParseScope(serializedScope)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	uplinkstorj, err = uplink.NewUplink(ctx, &cfg)
-	if err != nil {
-		log.Fatal("Could not create new Uplink object:", err)
-	}
-	proj, err := uplinkstorj.OpenProject(ctx, parsedScope.SatelliteAddr, parsedScope.APIKey)
-	if err != nil {
-		CloseProject(uplinkstorj, proj, nil)
-		log.Fatal("Could not open project:", err)
-	}
-	fmt.Println("Opening Bucket: ", downloadBucket)
-
-	// Open up the desired Bucket within the Project.
-	bucket, err := proj.OpenBucket(ctx, downloadBucket, parsedScope.EncryptionAccess)
-	if err != nil {
-		return fmt.Errorf("Could not open bucket %q: %s", downloadBucket, err)
-	}
-
-	// Download meta file from storj network.
-	metaFileName := downloadFileName + "/" + downloadFileName + ".txt"
-	//Get Meta data file from storj
-	readBackMeta, err := bucket.OpenObject(ctx, downloadPath+metaFileName)
-	if readBackMeta == nil {
-		log.Fatal("Could not read object: Access Denied")
-	}
-	if err != nil {
-		return fmt.Errorf("could not open object at %q: %v", downloadPath+metaFileName, err)
-	}
-	bucket.Close()
-	// We want the whole thing, so r a nge from 0 to -1.
-	strmMeta, err := readBackMeta.DownloadRange(ctx, 0, -1)
-	if err != nil {
-		return fmt.Errorf("Could not initiate download: %v", err)
-	}
-	readBackMeta.Close()
-
-	// Read everything from the stream.
-	receivedContentsMeta, err := ioutil.ReadAll(strmMeta)
-
-	strmMeta.Close()
-	//Convert byte array into String
-	receiveContentsMeta := string(receivedContentsMeta)
-
-	receiveContentsMeta = strings.TrimSuffix(receiveContentsMeta, ",")
-
-	downloadFileNamesDEBUG := strings.Split(receiveContentsMeta, ",")
-
-	var fileNameDownload = downloadConfigStorj.DownloadPath + "/" + lastFileName
-
-	os.Remove(fileNameDownload)
-	hmkey := []byte("This is a storj ipfs private key")
-
-	var downloadFileDisk *os.File
-	for _, filename := range downloadFileNamesDEBUG {
-		readBack, err := bucket.OpenObject(ctx, downloadPath+downloadFileName+"/"+filename)
-		if err != nil {
-			return fmt.Errorf("Could not open object at %q: %v", downloadPath+downloadFileName+"/"+filename, err)
-		}
-
-		fmt.Println("\nInitiating download...")
-		// We want the whole thing, so range from 0 to -1.
-		strm, err := readBack.DownloadRange(ctx, 0, -1)
-		if err != nil {
-			return fmt.Errorf("Could not initiate download: %v", err)
-		}
-		readBack.Close()
-		fmt.Printf("Downloading Object %s from bucket : Initiated...\n", filename)
-
-		// Read everything from the stream.
-		receivedContents, err := ioutil.ReadAll(strm)
-		if err != nil {
-			return fmt.Errorf("Could not Read All content in stream: %v", err)
-		}
-		strm.Close()
-
-		//Decryt the downloaded file data from storj
-
-		dec, err := decrypt(hmkey, receivedContents)
-		if err != nil {
-			return fmt.Errorf("Could not decrypt received data: %v", err)
-		}
-
-		// Store the downloaded file from storj in local disk
-
-		downloadFileDisk, err = os.OpenFile(fileNameDownload, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return fmt.Errorf("Could not open file to write downloaded data: %v", err)
-		}
-
-		if _, err := downloadFileDisk.Write(dec); err != nil {
-			log.Fatal(err)
-		}
-		downloadFileDisk.Sync()
-
-		downloadFileDisk.Close()
-
-		fmt.Printf("Downloaded %d bytes of Object from bucket!\n", len(receivedContents))
-
-	}
-	fmt.Printf("File downloading: Complete!\n")
-	fmt.Printf("\nFile \"%s\" downloaded to \"%s\"\n", lastFileName, downloadConfigStorj.DownloadPath)
-	return nil
+	return downloadConfigStorj, nil
 }
 
-// Function to decrypt data based on given key.
-func decrypt(key, text []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-	if len(text) < aes.BlockSize {
-		return nil, errors.New("ciphertext too short")
-	}
-	iv := text[:aes.BlockSize]
-	text = text[aes.BlockSize:]
-	cfb := cipher.NewCFBDecrypter(block, iv)
-	cfb.XORKeyStream(text, text)
-	data, err := base64.StdEncoding.DecodeString(string(text))
-	if err != nil {
-		return nil, err
+// StorjConfig returns the credentials, secret key, concurrency, timeouts and retry policy
+// of the download configuration as a Storj configuration.
+func (downloadConfigStorj DownloadConfigStorj) StorjConfig() ConfigStorj {
+	return ConfigStorj{
+		APIKey:               downloadConfigStorj.APIKey,
+		Satellite:            downloadConfigStorj.SatelliteURL,
+		EncryptionPassphrase: downloadConfigStorj.EncryptionPassphrase,
+		SerializedScope:      downloadConfigStorj.SerializedScope,
+		Key:                  downloadConfigStorj.Key,
+		Concurrency:          downloadConfigStorj.Concurrency,
+		ConnectTimeout:       downloadConfigStorj.ConnectTimeout,
+		ObjectTimeout:        downloadConfigStorj.ObjectTimeout,
+		RetryAttempts:        downloadConfigStorj.RetryAttempts,
+		RetryDeadline:        downloadConfigStorj.RetryDeadline,
 	}
-	iv = nil
-	text = nil
-	cfb = nil
-	return data, nil
 }
@@ -0,0 +1,48 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	errs "storj-ipfs/errs"
+)
+
+// refusingStore refuses every Put as the satellite refuses invalid credentials.
+type refusingStore struct {
+	ObjectStore
+}
+
+// Put fails with the message of refused credentials.
+func (store refusingStore) Put(ctx context.Context, path string, data io.Reader) error {
+	return errors.New("uplink: metainfo error: Unauthenticated: invalid API key")
+}
+
+func TestConnectUpload(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	if err := ConnectUpload(ctx, store, []byte("test"), "testdata", ConfigStorj{UploadPath: "uploads"}); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := store.Get(ctx, "uploads/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if data, err := ioutil.ReadAll(reader); err != nil || string(data) != "test" {
+		t.Errorf("uploaded %q: %v", data, err)
+	}
+
+	// Failures keep their kind, for the exit status of the test command.
+	if err := ConnectUpload(ctx, refusingStore{store}, []byte("test"), "testdata", ConfigStorj{UploadPath: "uploads/"}); !errors.Is(err, errs.ErrAccessDenied) {
+		t.Errorf("refused upload: %v, expected %v", err, errs.ErrAccessDenied)
+	}
+	if err := ConnectUpload(ctx, store, []byte("test"), "testdata", ConfigStorj{UploadPath: "uploads/", RetryAttempts: "none"}); !errors.Is(err, errs.ErrConfigInvalid) {
+		t.Errorf("invalid retry attempts: %v, expected %v", err, errs.ErrConfigInvalid)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"context"
+	"io"
+	"time"
+
+	timeouts "storj-ipfs/timeouts"
+)
+
+// WithTimeout returns ctx bounded by timeout, or ctx itself when timeout is zero.
+// The caller must call the returned cancel function.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutStore bounds every operation of an ObjectStore by a timeout.
+type timeoutStore struct {
+	store   ObjectStore
+	timeout time.Duration
+}
+
+// StoreWithTimeout returns store with every operation, including reading a downloaded object,
+// bounded by timeout, so a hung upload or download of a chunk fails instead of blocking.
+// A timeout of zero returns store unchanged.
+func StoreWithTimeout(store ObjectStore, timeout time.Duration) ObjectStore {
+	if timeout <= 0 {
+		return store
+	}
+	return &timeoutStore{store: store, timeout: timeout}
+}
+
+// Put uploads data within the timeout.
+func (store *timeoutStore) Put(ctx context.Context, path string, data io.Reader) error {
+	ctx, cancel := context.WithTimeout(ctx, store.timeout)
+	defer cancel()
+	return store.store.Put(ctx, path, data)
+}
+
+// Get returns the object under path, which must be read within the timeout.
+func (store *timeoutStore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(ctx, store.timeout)
+	reader, err := store.store.Get(ctx, path)
+	return timeouts.CancelOnClose(reader, err, cancel)
+}
+
+// GetRange returns part of the object under path, which must be read within the timeout.
+func (store *timeoutStore) GetRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(ctx, store.timeout)
+	reader, err := store.store.GetRange(ctx, path, offset, length)
+	return timeouts.CancelOnClose(reader, err, cancel)
+}
+
+// Stat returns information about the object under path within the timeout.
+func (store *timeoutStore) Stat(ctx context.Context, path string) (ObjectInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, store.timeout)
+	defer cancel()
+	return store.store.Stat(ctx, path)
+}
+
+// List lists the objects under prefix within the timeout.
+func (store *timeoutStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, store.timeout)
+	defer cancel()
+	return store.store.List(ctx, prefix)
+}
+
+// Delete removes the object under path within the timeout.
+func (store *timeoutStore) Delete(ctx context.Context, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, store.timeout)
+	defer cancel()
+	return store.store.Delete(ctx, path)
+}
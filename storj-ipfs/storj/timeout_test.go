@@ -0,0 +1,164 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hangingStore hangs in every Put, Get and GetRange until its context is done,
+// counting the calls that were stopped that way. Objects put in the embedded store
+// before can be read, but reading them hangs too.
+type hangingStore struct {
+	ObjectStore
+
+	mu      sync.Mutex
+	calls   int
+	stopped int
+}
+
+// hang waits for ctx to be done and returns its error.
+func (store *hangingStore) hang(ctx context.Context) error {
+	store.mu.Lock()
+	store.calls++
+	store.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		store.mu.Lock()
+		store.stopped++
+		store.mu.Unlock()
+		return ctx.Err()
+	case <-time.After(10 * time.Second):
+		return errors.New("operation was not stopped")
+	}
+}
+
+// Put hangs.
+func (store *hangingStore) Put(ctx context.Context, path string, data io.Reader) error {
+	return store.hang(ctx)
+}
+
+// Get hangs.
+func (store *hangingStore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	return nil, store.hang(ctx)
+}
+
+// GetRange returns a reader of the object hanging in its first read.
+func (store *hangingStore) GetRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := store.ObjectStore.GetRange(ctx, path, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return &hangingReader{ReadCloser: reader, ctx: ctx, store: store}, nil
+}
+
+// hangingReader hangs in Read until the context of the Get that opened it is done.
+type hangingReader struct {
+	io.ReadCloser
+	ctx   context.Context
+	store *hangingStore
+}
+
+// Read hangs.
+func (reader *hangingReader) Read(data []byte) (int, error) {
+	return 0, reader.store.hang(reader.ctx)
+}
+
+func TestStoreWithTimeout(t *testing.T) {
+	ctx := context.Background()
+	hung := &hangingStore{ObjectStore: NewMemStore()}
+	if err := hung.ObjectStore.Put(ctx, "object", bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatal(err)
+	}
+	if store := StoreWithTimeout(hung, 0); store != ObjectStore(hung) {
+		t.Error("a timeout of zero changed the store")
+	}
+
+	store := StoreWithTimeout(hung, 20*time.Millisecond)
+	for name, operation := range map[string]func() error{
+		"put": func() error {
+			return store.Put(ctx, "object", bytes.NewReader([]byte("data")))
+		},
+		"get": func() error {
+			_, err := store.Get(ctx, "object")
+			return err
+		},
+		"read": func() error {
+			reader, err := store.GetRange(ctx, "object", 0, -1)
+			if err != nil {
+				return err
+			}
+			defer reader.Close()
+			_, err = ioutil.ReadAll(reader)
+			return err
+		},
+	} {
+		start := time.Now()
+		if err := operation(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("hung %s: %v, expected %v", name, err, context.DeadlineExceeded)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("hung %s failed after %v", name, elapsed)
+		}
+	}
+	if hung.stopped != hung.calls {
+		t.Errorf("%d of %d operations stopped", hung.stopped, hung.calls)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), 0)
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("a timeout of zero set a deadline")
+	}
+	cancel()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("cancelled context: %v", ctx.Err())
+	}
+
+	ctx, cancel = WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	hung := &hangingStore{ObjectStore: NewMemStore()}
+	if err := hung.Put(ctx, "object", bytes.NewReader([]byte("data"))); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("hung put: %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestUploadChunksTimeout(t *testing.T) {
+	hung := &hangingStore{ObjectStore: NewMemStore()}
+	data := testData(40, testFileSize)
+
+	_, err := UploadChunks(context.Background(), StoreWithTimeout(hung, 20*time.Millisecond), bytes.NewReader(data), testBoundaries(data), uploadOptions(t, 4))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("upload: %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestUploadChunksCancel(t *testing.T) {
+	hung := &hangingStore{ObjectStore: NewMemStore()}
+	data := testData(41, testFileSize)
+	options := uploadOptions(t, 4)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := UploadChunks(ctx, hung, bytes.NewReader(data), testBoundaries(data), options)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("upload: %v, expected %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("upload stopped after %v", elapsed)
+	}
+	// Every worker was in a Put, and all of them were stopped.
+	if hung.calls != options.Concurrency || hung.stopped != hung.calls {
+		t.Errorf("%d of %d puts stopped, expected %d", hung.stopped, hung.calls, options.Concurrency)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	logging "storj-ipfs/logging"
+)
+
+// ScanDirectory walks root and returns an entry for every directory and regular file below it,
+// in path order, with the size and SHA-256 digest of every file.
+// Symbolic links and other special files are skipped and logged to logger.
+func ScanDirectory(root string, logger *logging.Logger) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	err := filepath.Walk(root, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(root, fullPath)
+		if err != nil {
+			return err
+		}
+		if relativePath == "." {
+			return nil
+		}
+
+		entry := ManifestEntry{
+			Path:    filepath.ToSlash(relativePath),
+			Mode:    uint32(info.Mode().Perm()),
+			ModTime: info.ModTime().UTC(),
+		}
+		switch {
+		case info.IsDir():
+			entry.Dir = true
+		case info.Mode().IsRegular():
+			entry.Size = info.Size()
+			entry.Digest, err = fileDigest(fullPath)
+			if err != nil {
+				return err
+			}
+		default:
+			logger.Warn("Skipping file that is not a regular file", logging.Any("path", entry.Path))
+			return nil
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read directory %q: %v", root, err)
+	}
+	return entries, nil
+}
+
+// DirectoryListing returns a listing of entries with one "digest size path" line per file
+// and one "dir path" line per directory. Its CID is the base CID of a stored directory,
+// so it changes whenever a file's content or the directory structure changes.
+func DirectoryListing(entries []ManifestEntry) []byte {
+	var listing bytes.Buffer
+	for _, entry := range entries {
+		if entry.Dir {
+			fmt.Fprintf(&listing, "dir %s\n", entry.Path)
+		} else {
+			fmt.Fprintf(&listing, "%s %d %s\n", entry.Digest, entry.Size, entry.Path)
+		}
+	}
+	return listing.Bytes()
+}
+
+// UploadDirectory uploads every file in entries, read from below root and split
+// with the chunker setting, and sets the chunks of each entry with UploadEntry.
+// It fails if a file no longer matches the size and digest it was scanned with.
+func UploadDirectory(ctx context.Context, store ObjectStore, root string, entries []ManifestEntry, setting string, options UploadOptions) error {
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Dir {
+			continue
+		}
+		size, digest := entry.Size, entry.Digest
+
+		file, err := os.Open(filepath.Join(root, filepath.FromSlash(entry.Path)))
+		if err != nil {
+			return fmt.Errorf("could not open %s: %v", entry.Path, err)
+		}
+		err = UploadEntry(ctx, store, entry, io.NewSectionReader(file, 0, size), setting, options)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		if entry.Size != size || entry.Digest != digest {
+			return fmt.Errorf("%s changed while it was being stored", entry.Path)
+		}
+	}
+	return nil
+}
+
+// UploadEntry uploads the content of the file entry read from source, split with the chunker
+// setting, with UploadChunks and options, and sets the chunks, size and digest of entry.
+// Chunks are sealed with keys derived from the file key of the entry's path and,
+// if options.Journal is set, recorded in the entry's own journal next to it.
+func UploadEntry(ctx context.Context, store ObjectStore, entry *ManifestEntry, source *io.SectionReader, setting string, options UploadOptions) error {
+	logger := logging.FromContext(ctx).With(logging.Any("path", entry.Path))
+	logger.Info("Uploading file")
+
+	fileOptions := options
+	var err error
+	fileOptions.DataKey, err = FileKey(options.DataKey, entry.Path)
+	if err != nil {
+		return err
+	}
+	if options.Journal != nil {
+		fileOptions.Journal, err = options.Journal.EntryJournal(entry.Path, options.Resume)
+		if err != nil {
+			return err
+		}
+	}
+
+	boundaries, err := NewBoundaries(source, setting)
+	if err != nil {
+		return err
+	}
+	chunks, err := UploadChunks(ctx, store, source, boundaries, fileOptions)
+	if err != nil {
+		return fmt.Errorf("could not upload %s: %w", entry.Path, err)
+	}
+
+	entry.Size = 0
+	for _, chunk := range chunks {
+		entry.Size += chunk.Size
+	}
+	// The file is hashed once more after its chunks, so a change while they were read
+	// makes the digest differ from the one scanned.
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(source, 0, source.Size())); err != nil {
+		return fmt.Errorf("could not read %s: %w", entry.Path, err)
+	}
+	entry.Digest = hex.EncodeToString(hash.Sum(nil))
+	entry.Chunks = chunks
+	logger.Info("Uploaded file", logging.Any("size", entry.Size))
+	return nil
+}
+
+// entryTarget returns where the entry at entryPath of a stored directory is written below root.
+// Paths that are absolute or leave root are rejected, and so are paths with a backslash
+// or starting with a drive letter, which would be read as such on Windows.
+func entryTarget(root string, entryPath string) (string, error) {
+	cleaned := path.Clean(entryPath)
+	if entryPath == "" || path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid path %q in manifest", entryPath)
+	}
+	if strings.ContainsRune(entryPath, '\\') || (len(cleaned) >= 2 && cleaned[1] == ':') || filepath.VolumeName(filepath.FromSlash(cleaned)) != "" {
+		return "", fmt.Errorf("invalid path %q in manifest", entryPath)
+	}
+	return filepath.Join(root, filepath.FromSlash(cleaned)), nil
+}
+
+// fileDigest returns the hex encoded SHA-256 digest of the file at fullPath.
+func fileDigest(fullPath string) (string, error) {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
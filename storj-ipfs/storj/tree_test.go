@@ -0,0 +1,36 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestEntryTarget(t *testing.T) {
+	root := filepath.Join("download", "dir")
+	for _, test := range []struct {
+		path   string
+		target string
+	}{
+		{path: "a.txt", target: filepath.Join(root, "a.txt")},
+		{path: "sub/a.txt", target: filepath.Join(root, "sub", "a.txt")},
+		{path: "sub/../a.txt", target: filepath.Join(root, "a.txt")},
+		{path: "./sub//a.txt", target: filepath.Join(root, "sub", "a.txt")},
+		{path: "..a.txt", target: filepath.Join(root, "..a.txt")},
+	} {
+		target, err := entryTarget(root, test.path)
+		if err != nil || target != test.target {
+			t.Errorf("%q: target %q, expected %q: %v", test.path, target, test.target, err)
+		}
+	}
+
+	for _, path := range []string{"", ".", "./", "..", "../a.txt", "sub/../../a.txt", "/a.txt", "/etc/passwd", "//a.txt",
+		`..\a.txt`, `sub\..\..\a.txt`, `\a.txt`, `\\server\share\a.txt`, `C:\a.txt`, `C:a.txt`, "C:/a.txt", `sub/..\a.txt`,
+	} {
+		if target, err := entryTarget(root, path); err == nil {
+			t.Errorf("%q: accepted as %q", path, target)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	errs "storj-ipfs/errs"
+	logging "storj-ipfs/logging"
+
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultConcurrency is the number of chunks transferred at once when none is configured.
+const DefaultConcurrency = 4
+
+// ParseConcurrency converts a configured number of concurrent chunk transfers,
+// falling back to DefaultConcurrency when it is empty.
+func ParseConcurrency(value string) (int, error) {
+	if value == "" {
+		return DefaultConcurrency, nil
+	}
+	concurrency, err := strconv.Atoi(value)
+	if err != nil || concurrency <= 0 {
+		return 0, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("Invalid concurrency %q", value))
+	}
+	return concurrency, nil
+}
+
+// NewSplitter returns a splitter reading from reader for a go-ipfs-chunker setting:
+// "size-N" for fixed size chunks, or the content-defined "rabin", "rabin-avg",
+// "rabin-min-avg-max" and "buzhash", whose chunk boundaries follow the content,
+// so an edit only changes the chunks around it. Fixed sizes are not limited to
+// the largest chunk the daemon accepts, as chunks are not added to IPFS.
+func NewSplitter(reader io.Reader, setting string) (chunker.Splitter, error) {
+	if strings.HasPrefix(setting, "size-") {
+		size, err := parseChunkSize(setting)
+		if err != nil {
+			return nil, err
+		}
+		return chunker.NewSizeSplitter(reader, size), nil
+	}
+	if setting == "" || setting == "default" {
+		return nil, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("Invalid chunker %q", setting))
+	}
+	splitter, err := chunker.FromString(reader, setting)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrConfigInvalid, err, "Invalid chunker %q", setting)
+	}
+	return splitter, nil
+}
+
+// parseChunkSize returns the size of the fixed size chunker setting "size-N".
+func parseChunkSize(setting string) (int64, error) {
+	size, err := strconv.ParseInt(strings.TrimPrefix(setting, "size-"), 10, 64)
+	if err != nil || size <= 0 {
+		return 0, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("Invalid chunker %q", setting))
+	}
+	return size, nil
+}
+
+// Boundaries sets where the chunks of data end, without keeping their content.
+type Boundaries interface {
+	// NextSize returns the size of the next chunk, or io.EOF after the last one.
+	NextSize() (int64, error)
+}
+
+// NewBoundaries returns the boundaries of the chunks NewSplitter would split source into
+// with the chunker setting. Fixed size boundaries are computed from the size of source
+// without reading it, so the chunk size does not bound the memory a store uses.
+// Content-defined chunkers read source to find the boundaries, holding only the chunk
+// they are cutting, at most their maximum chunk size, until it is cut.
+func NewBoundaries(source *io.SectionReader, setting string) (Boundaries, error) {
+	if strings.HasPrefix(setting, "size-") {
+		size, err := parseChunkSize(setting)
+		if err != nil {
+			return nil, err
+		}
+		return &sizeBoundaries{size: size, remaining: source.Size()}, nil
+	}
+	splitter, err := NewSplitter(io.NewSectionReader(source, 0, source.Size()), setting)
+	if err != nil {
+		return nil, err
+	}
+	return splitterBoundaries{splitter: splitter}, nil
+}
+
+// sizeBoundaries cuts data of a known size into chunks of a fixed size and a shorter last chunk.
+type sizeBoundaries struct {
+	size      int64
+	remaining int64
+}
+
+// NextSize returns the size of the next chunk.
+func (boundaries *sizeBoundaries) NextSize() (int64, error) {
+	if boundaries.remaining <= 0 {
+		return 0, io.EOF
+	}
+	size := boundaries.size
+	if size > boundaries.remaining {
+		size = boundaries.remaining
+	}
+	boundaries.remaining -= size
+	return size, nil
+}
+
+// splitterBoundaries returns the sizes of the chunks of a splitter, dropping their content.
+type splitterBoundaries struct {
+	splitter chunker.Splitter
+}
+
+// NextSize returns the size of the next chunk the splitter cuts.
+func (boundaries splitterBoundaries) NextSize() (int64, error) {
+	data, err := boundaries.splitter.NextBytes()
+	return int64(len(data)), err
+}
+
+// Spool copies data to a temporary file, as UploadChunks reads every chunk again from its source,
+// and returns a reader over the file and a function removing it.
+func Spool(data io.Reader) (*io.SectionReader, func(), error) {
+	file, err := ioutil.TempFile("", "storj-ipfs-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	size, err := io.Copy(file, data)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("could not read data: %w", err)
+	}
+	return io.NewSectionReader(file, 0, size), cleanup, nil
+}
+
+// ValidateChunker checks a chunker setting without reading any data.
+func ValidateChunker(setting string) error {
+	_, err := NewSplitter(strings.NewReader(""), setting)
+	return err
+}
+
+// MetaFileName returns the name of the meta file of baseCID below the upload path: baseCID/baseCID.txt.
+func MetaFileName(baseCID string) string {
+	return baseCID + "/" + baseCID + ".txt"
+}
+
+// UploadManifest stores manifest as the meta file of baseCID below uploadPath, retrying as retry allows.
+func UploadManifest(ctx context.Context, store ObjectStore, uploadPath string, baseCID string, manifest *Manifest, retry RetryPolicy) error {
+	metadataBytes, err := manifest.Marshal()
+	if err != nil {
+		return err
+	}
+	logger := logging.FromContext(ctx).With(logging.Any("object", uploadPath+MetaFileName(baseCID)))
+	logger.Info("Uploading meta file")
+	if err := uploadObject(ctx, store, uploadPath+MetaFileName(baseCID), metadataBytes, retry); err != nil {
+		return fmt.Errorf("Could not upload meta file: %w", err)
+	}
+	logger.Info("Uploaded meta file")
+	return nil
+}
+
+// WorkerBufferSize bounds the memory an upload worker uses: one plaintext and one sealed
+// segment of SealStream, and one leaf read by the CID computation. The chunk's digest is
+// streamed first through the smaller buffer of io.Copy.
+const WorkerBufferSize = 2*StreamSegmentSize + 256*1024
+
+// UploadOptions configures UploadChunks.
+type UploadOptions struct {
+	// Prefix is prepended to each chunk CID to form its object path.
+	Prefix string
+	// Algorithm and DataKey seal each chunk with its derived chunk key.
+	Algorithm Algorithm
+	DataKey   []byte
+	// Concurrency is the number of chunks encrypted and uploaded at once.
+	Concurrency int
+	// ChunkCID returns the CID of an encrypted chunk read from data.
+	ChunkCID func(data io.Reader) (string, error)
+	// Journal, if set, records every uploaded chunk.
+	Journal *Journal
+	// Resume skips chunks recorded in Journal that are still present in the store.
+	Resume bool
+	// Dedup, if set, stores chunks as shared chunks, uploading only those not stored yet.
+	Dedup *Dedup
+	// Retry retries each chunk upload failing with a transient error.
+	Retry RetryPolicy
+}
+
+// chunkJob is a range of the plaintext waiting to be encrypted and uploaded.
+type chunkJob struct {
+	index  int
+	offset int64
+	size   int64
+	// digest is the SHA-256 of the chunk's plaintext, taken by the worker.
+	digest []byte
+}
+
+// UploadChunks encrypts, hashes and uploads every chunk of source, with up to
+// options.Concurrency chunks in flight. boundaries must cut the same data as source from its start:
+// only the chunk ranges are passed on to the workers. Workers stream their chunk's range of source
+// three times, once for its digest, once for its CID and once for the upload, through SealStream,
+// so no chunk is held as a whole: the memory used is bounded by Concurrency*WorkerBufferSize,
+// plus the buffers of boundaries and of the store, whatever the chunk size.
+// The first error cancels all workers. The returned manifest entries are in chunk order.
+func UploadChunks(ctx context.Context, store ObjectStore, source io.ReaderAt, boundaries Boundaries, options UploadOptions) ([]ManifestChunk, error) {
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	group, ctx := errgroup.WithContext(ctx)
+	jobs := make(chan chunkJob, concurrency)
+
+	var mu sync.Mutex
+	uploaded := make(map[int]ManifestChunk)
+
+	// Cut the data in order and hand the chunk ranges to the workers.
+	group.Go(func() error {
+		defer close(jobs)
+		var offset int64
+		for index := 0; ; index++ {
+			size, err := boundaries.NextSize()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("could not read chunk %d: %w", index, err)
+			}
+			job := chunkJob{index: index, offset: offset, size: size}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			offset += job.size
+		}
+	})
+
+	for i := 0; i < concurrency; i++ {
+		group.Go(func() error {
+			for job := range jobs {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				chunk, err := uploadChunk(ctx, store, source, job, options)
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				uploaded[job.index] = chunk
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	chunks := make([]ManifestChunk, len(uploaded))
+	for index, chunk := range uploaded {
+		chunks[index] = chunk
+	}
+	return chunks, nil
+}
+
+// uploadChunk seals a single chunk read from source, computes its CID and uploads it under Prefix+CID.
+func uploadChunk(ctx context.Context, store ObjectStore, source io.ReaderAt, job chunkJob, options UploadOptions) (ManifestChunk, error) {
+	plaintext := io.NewSectionReader(source, job.offset, job.size)
+	hash := sha256.New()
+	if n, err := io.Copy(hash, plaintext); err != nil || n != job.size {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return ManifestChunk{}, fmt.Errorf("could not read chunk %d: %w", job.index, err)
+	}
+	job.digest = hash.Sum(nil)
+
+	if options.Dedup != nil {
+		// Shared chunks already stored are found by their name, so the journal is only written.
+		chunk, err := uploadSharedChunk(ctx, store, plaintext, job, options)
+		if err != nil {
+			return ManifestChunk{}, err
+		}
+		if options.Journal != nil {
+			if err := options.Journal.Record(job.index, chunk); err != nil {
+				return ManifestChunk{}, err
+			}
+		}
+		return chunk, nil
+	}
+
+	digest := hex.EncodeToString(job.digest)
+	if options.Resume && options.Journal != nil {
+		if chunk, ok := resumableChunk(ctx, store, job, digest, options); ok {
+			logging.FromContext(ctx).Debug("Skipping chunk already uploaded", logging.Any("chunk", job.index))
+			return chunk, nil
+		}
+	}
+
+	key, err := ChunkKey(options.DataKey, job.index)
+	if err != nil {
+		return ManifestChunk{}, err
+	}
+	// The chunk is read from source and sealed twice, first for its CID and then to the store,
+	// so neither its plaintext nor its envelope is held in memory as a whole.
+	seal := func() (io.Reader, error) {
+		sealed, _, err := SealStream(options.Algorithm, key, uint64(job.index), plaintext, job.digest)
+		return sealed, err
+	}
+	sealed, encryptedSize, err := SealStream(options.Algorithm, key, uint64(job.index), plaintext, job.digest)
+	if err != nil {
+		return ManifestChunk{}, fmt.Errorf("could not encrypt chunk %d: %v", job.index, err)
+	}
+
+	chunkCID, err := options.ChunkCID(sealed)
+	if err != nil {
+		return ManifestChunk{}, fmt.Errorf("could not create CID of chunk %d: %v", job.index, err)
+	}
+
+	logger := logging.FromContext(ctx).With(logging.Any("chunk", job.index), logging.Any("object", options.Prefix+chunkCID))
+	logger.Debug("Uploading chunk", logging.Any("size", encryptedSize))
+	if err := uploadStream(ctx, store, options.Prefix+chunkCID, seal, options.Retry); err != nil {
+		return ManifestChunk{}, fmt.Errorf("could not upload chunk %d: %w", job.index, err)
+	}
+	logger.Debug("Uploaded chunk")
+
+	chunk := ManifestChunk{
+		CID:           chunkCID,
+		Offset:        job.offset,
+		Size:          job.size,
+		EncryptedSize: encryptedSize,
+		Digest:        digest,
+	}
+	if options.Journal != nil {
+		if err := options.Journal.Record(job.index, chunk); err != nil {
+			return ManifestChunk{}, err
+		}
+	}
+	return chunk, nil
+}
+
+// resumableChunk returns the journal entry for job if it describes the same plaintext
+// and the object it points to is still in the store with the recorded size.
+func resumableChunk(ctx context.Context, store ObjectStore, job chunkJob, digest string, options UploadOptions) (ManifestChunk, bool) {
+	chunk, ok := options.Journal.Chunk(job.index)
+	if !ok || chunk.Digest != digest || chunk.Offset != job.offset {
+		return ManifestChunk{}, false
+	}
+	info, err := store.Stat(ctx, options.Prefix+chunk.CID)
+	if err != nil || info.Size != chunk.EncryptedSize {
+		return ManifestChunk{}, false
+	}
+	return chunk, true
+}
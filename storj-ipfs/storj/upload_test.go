@@ -0,0 +1,204 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package storj
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	errs "storj-ipfs/errs"
+)
+
+// delayStore waits a random delay of up to maxDelay before every Put,
+// so the chunks of an upload finish out of order.
+type delayStore struct {
+	ObjectStore
+
+	mu       sync.Mutex
+	random   *rand.Rand
+	maxDelay time.Duration
+}
+
+// Put stores data after a random delay.
+func (store *delayStore) Put(ctx context.Context, path string, data io.Reader) error {
+	store.mu.Lock()
+	delay := time.Duration(store.random.Int63n(int64(store.maxDelay)))
+	store.mu.Unlock()
+	time.Sleep(delay)
+	return store.ObjectStore.Put(ctx, path, data)
+}
+
+// uploadOptions returns the options of an upload of testBaseCID with a new data key.
+func uploadOptions(t *testing.T, concurrency int) UploadOptions {
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return UploadOptions{
+		Prefix:      testUploadPath + testBaseCID + "/",
+		Algorithm:   AlgorithmAESGCM,
+		DataKey:     dataKey,
+		Concurrency: concurrency,
+		ChunkCID:    testChunkCID,
+		Retry:       RetryPolicy{Attempts: 1},
+	}
+}
+
+func TestUploadChunksOrder(t *testing.T) {
+	store := &delayStore{ObjectStore: NewMemStore(), random: rand.New(rand.NewSource(1)), maxDelay: 5 * time.Millisecond}
+	data := testData(10, 3*testFileSize)
+	options := uploadOptions(t, 8)
+
+	chunks, err := UploadChunks(context.Background(), store, bytes.NewReader(data), testBoundaries(data), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (len(data) + testChunkSize - 1) / testChunkSize; len(chunks) != expected {
+		t.Fatalf("%d chunks, expected %d", len(chunks), expected)
+	}
+	var offset int64
+	for index, chunk := range chunks {
+		end := offset + testChunkSize
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		if chunk.Offset != offset || chunk.Size != end-offset || chunk.Digest != ChunkDigest(data[offset:end]) {
+			t.Fatalf("chunk %d describes %d bytes at %d, expected %d at %d", index, chunk.Size, chunk.Offset, end-offset, offset)
+		}
+		offset = end
+	}
+
+	downloaded := &bytes.Buffer{}
+	if _, err := downloaded.ReadFrom(StreamChunks(context.Background(), store, chunks, options.Prefix, options.DataKey, RetryPolicy{})); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded.Bytes(), data) {
+		t.Error("download differs from the upload")
+	}
+}
+
+// failingStore fails the Put numbered fail and blocks every other Put until its context is done,
+// counting the Puts that were cancelled.
+type failingStore struct {
+	ObjectStore
+
+	mu        sync.Mutex
+	puts      int
+	fail      int
+	cancelled int
+}
+
+// Put fails, or waits for its context to be done.
+func (store *failingStore) Put(ctx context.Context, path string, data io.Reader) error {
+	store.mu.Lock()
+	store.puts++
+	failed := store.puts == store.fail
+	store.mu.Unlock()
+	if failed {
+		return errFaulty
+	}
+
+	select {
+	case <-ctx.Done():
+		store.mu.Lock()
+		store.cancelled++
+		store.mu.Unlock()
+		return ctx.Err()
+	case <-time.After(10 * time.Second):
+		return errors.New("put was not cancelled")
+	}
+}
+
+func TestUploadChunksCancelsOnError(t *testing.T) {
+	store := &failingStore{ObjectStore: NewMemStore(), fail: 3}
+	data := testData(11, testFileSize)
+	options := uploadOptions(t, 4)
+
+	_, err := UploadChunks(context.Background(), store, bytes.NewReader(data), testBoundaries(data), options)
+	if !errors.Is(err, errFaulty) {
+		t.Fatalf("upload: %v, expected %v", err, errFaulty)
+	}
+	// The two puts before the failing one were in flight and stopped by it.
+	if store.cancelled < 2 {
+		t.Errorf("%d puts cancelled, expected at least 2", store.cancelled)
+	}
+	// No chunk is uploaded after the failure.
+	if store.puts > options.Concurrency {
+		t.Errorf("%d puts, expected at most the %d in flight", store.puts, options.Concurrency)
+	}
+}
+
+func TestNewSplitter(t *testing.T) {
+	data := testData(30, 4*testFileSize)
+	for _, setting := range []string{"size-1", "size-7000", "size-4194304", "rabin", "rabin-8192", "rabin-2048-8192-32768", "rabin-min:2048-avg:8192-max:32768", "buzhash"} {
+		splitter, err := NewSplitter(bytes.NewReader(data), setting)
+		if err != nil {
+			t.Errorf("%q: %v", setting, err)
+			continue
+		}
+		if err := ValidateChunker(setting); err != nil {
+			t.Errorf("%q: not valid: %v", setting, err)
+		}
+		if setting == "size-1" {
+			continue
+		}
+
+		// The chunks are the data in order.
+		var split []byte
+		var sizes []int64
+		for {
+			chunk, err := splitter.NextBytes()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%q: %v", setting, err)
+			}
+			split = append(split, chunk...)
+			sizes = append(sizes, int64(len(chunk)))
+		}
+		if !bytes.Equal(split, data) {
+			t.Errorf("%q: %d bytes split, expected %d", setting, len(split), len(data))
+		}
+
+		// The boundaries cut the same chunks.
+		boundaries, err := NewBoundaries(io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), setting)
+		if err != nil {
+			t.Fatalf("%q: %v", setting, err)
+		}
+		var cut []int64
+		for {
+			size, err := boundaries.NextSize()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%q: %v", setting, err)
+			}
+			cut = append(cut, size)
+		}
+		if !reflect.DeepEqual(cut, sizes) {
+			t.Errorf("%q: boundaries cut %d chunks, expected the %d split", setting, len(cut), len(sizes))
+		}
+	}
+
+	for _, setting := range []string{"", "default", "size-", "size-0", "size--5", "size-x", "rabin-x", "rabin-1-2", "rabin-8-16-32", "rabin-8192-2048-32768", "rabin-2048-8192-4096", "rabin-max:2048-avg:8192-min:32768", "buzhash-8192", "fixed"} {
+		if _, err := NewSplitter(bytes.NewReader(data), setting); !errors.Is(err, errs.ErrConfigInvalid) {
+			t.Errorf("%q: %v, expected %v", setting, err, errs.ErrConfigInvalid)
+		}
+		if _, err := NewBoundaries(io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), setting); !errors.Is(err, errs.ErrConfigInvalid) {
+			t.Errorf("%q: boundaries %v, expected %v", setting, err, errs.ErrConfigInvalid)
+		}
+		if err := ValidateChunker(setting); err == nil {
+			t.Errorf("%q: valid", setting)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package timeouts reads the configured timeouts of the ipfs, storj and connector packages
+// and bounds the readers opened within them.
+package timeouts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	errs "storj-ipfs/errs"
+)
+
+// Parse converts a configured timeout such as "30s" or "2m",
+// falling back to zero, meaning no limit, when it is empty.
+func Parse(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, errs.New(errs.ErrConfigInvalid, fmt.Sprintf("Invalid timeout %q", value))
+	}
+	return timeout, nil
+}
+
+// cancelReader cancels the context of the reader it wraps when it is closed.
+type cancelReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the reader and cancels its context.
+func (reader *cancelReader) Close() error {
+	err := reader.ReadCloser.Close()
+	reader.cancel()
+	return err
+}
+
+// CancelOnClose returns reader, cancelling its context when it is closed,
+// or cancels the context right away if opening the reader failed with err.
+func CancelOnClose(reader io.ReadCloser, err error, cancel context.CancelFunc) (io.ReadCloser, error) {
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &cancelReader{ReadCloser: reader, cancel: cancel}, nil
+}
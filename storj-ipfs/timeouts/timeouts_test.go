@@ -0,0 +1,48 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package timeouts
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	errs "storj-ipfs/errs"
+)
+
+func TestParse(t *testing.T) {
+	for value, expected := range map[string]time.Duration{"": 0, "0s": 0, "30s": 30 * time.Second, "2m": 2 * time.Minute, "1h30m": 90 * time.Minute} {
+		if timeout, err := Parse(value); err != nil || timeout != expected {
+			t.Errorf("%q: %v, expected %v: %v", value, timeout, expected, err)
+		}
+	}
+	for _, value := range []string{"30", "x", "-1s", "2 minutes"} {
+		if _, err := Parse(value); !errors.Is(err, errs.ErrConfigInvalid) {
+			t.Errorf("%q: %v, expected %v", value, err, errs.ErrConfigInvalid)
+		}
+	}
+}
+
+func TestCancelOnClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, err := CancelOnClose(ioutil.NopCloser(strings.NewReader("data")), nil, cancel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("cancelled before the reader was closed")
+	}
+	if err := reader.Close(); err != nil || ctx.Err() != context.Canceled {
+		t.Errorf("closed with %v, context %v", err, ctx.Err())
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	failed := errors.New("failed")
+	if reader, err := CancelOnClose(nil, failed, cancel); reader != nil || err != failed || ctx.Err() != context.Canceled {
+		t.Errorf("failed open: %v, %v, context %v", reader, err, ctx.Err())
+	}
+}